@@ -2,6 +2,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"tp-plugin/internal/bootstrap"
@@ -29,6 +30,21 @@ func main() {
 			},
 		},
 		Action: run,
+		Commands: []*cli.Command{
+			{
+				Name:  "dry-run",
+				Usage: "preview one sync pass for an access point without side effects, print JSON report",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "access-point",
+						Aliases:  []string{"a"},
+						Usage:    "service access point ID",
+						Required: true,
+					},
+				},
+				Action: dryRun,
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -52,3 +68,14 @@ func run(c *cli.Context) error {
 	// 阻塞主goroutine，等待信号
 	select {}
 }
+
+func dryRun(c *cli.Context) error {
+	report, err := bootstrap.DryRun(c.String("config"), c.String("access-point"))
+	if err != nil {
+		return fmt.Errorf("同步预览失败: %v", err)
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	return out.Encode(report)
+}
@@ -3,8 +3,13 @@ package bootstrap
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
 	"time"
 	"tp-plugin/internal/config"
+	"tp-plugin/internal/health"
+	"tp-plugin/internal/pkg/logger"
 	"tp-plugin/internal/platform"
 	"tp-plugin/internal/protocol"
 	"tp-plugin/internal/protocol/plugins/go2rtc"
@@ -17,10 +22,14 @@ type AppContext struct {
 	Config          *config.Config
 	PlatformClient  *platform.PlatformClient
 	ProtocolHandler *protocol.SingleProtocolHandler
-	SyncService     *go2rtc.DeviceSyncService // 设备同步服务
+	SyncManager     *go2rtc.SyncManager   // 按服务接入点管理的设备同步服务
+	ConfigWatcher   *go2rtc.ConfigWatcher // go2rtc配置文件监听，未启用时为nil
+	Controls        *go2rtc.ControlProcessor
+	Teardown        *go2rtc.Teardown // 平台删除或断开设备后的清理
+	HTTPServer      *http.Server
+	Health          *health.Monitor // 平台心跳与健康状态
 	ctx             context.Context
 	cancel          context.CancelFunc
-	heartbeatTicker *time.Ticker // 心跳定时器
 }
 
 // Shutdown 关闭应用程序
@@ -29,9 +38,29 @@ func (app *AppContext) Shutdown() {
 		app.cancel()
 	}
 
+	// 停止HTTP服务
+	if app.HTTPServer != nil {
+		app.HTTPServer.Close()
+	}
+
+	// 停止心跳，适配器自身设备置为离线
+	if app.Health != nil {
+		app.Health.Stop()
+	}
+
+	// 停止go2rtc配置文件监听
+	if app.ConfigWatcher != nil {
+		app.ConfigWatcher.Stop()
+	}
+
+	// 停止录像与定时抓图
+	if app.Controls != nil {
+		app.Controls.Stop()
+	}
+
 	// 停止设备同步服务
-	if app.SyncService != nil {
-		app.SyncService.Stop()
+	if app.SyncManager != nil {
+		app.SyncManager.Stop()
 	}
 
 	// 停止协议处理器
@@ -45,11 +74,6 @@ func (app *AppContext) Shutdown() {
 		app.PlatformClient.Close()
 	}
 
-	// 停止心跳定时器
-	if app.heartbeatTicker != nil {
-		app.heartbeatTicker.Stop()
-	}
-
 	logrus.Info("应用资源已释放")
 }
 
@@ -82,43 +106,33 @@ func StartApp(configPath string) (*AppContext, error) {
 	}
 	app.PlatformClient = platformClient
 
-	// 5. 启动心跳定时器 - 每分钟发送一次心跳
-	app.heartbeatTicker = time.NewTicker(time.Second * time.Duration(cfg.Server.HeartbeatTimeout))
-	go func() {
-		// 启动时立即发送一次心跳
-		if err := platformClient.SendHeartbeat(ctx, cfg.Platform.ServiceIdentifier); err != nil {
-			logrus.WithError(err).Error("首次发送心跳失败")
-		} else {
-			logrus.Info("首次心跳发送成功")
-		}
-
-		// 定时发送心跳
-		for {
-			select {
-			case <-app.heartbeatTicker.C:
-				if err := platformClient.SendHeartbeat(ctx, cfg.Platform.ServiceIdentifier); err != nil {
-					logrus.WithError(err).Error("发送心跳失败")
-				} else {
-					logrus.Debug("心跳发送成功")
-				}
-			case <-ctx.Done():
-				logrus.Info("心跳上报已停止")
-				return
-			}
-		}
-	}()
-
-	// 6. 初始化单协议处理器
+	// 5. 初始化单协议处理器
 	if err := initializeProtocol(app, cfg); err != nil {
 		app.Shutdown()
 		return nil, err
 	}
 
+	// 6. 启动心跳，平台连续无响应时自动恢复
+	app.Health = health.NewMonitor(platformClient, app.SyncManager, logrus.StandardLogger(), health.Config{
+		ServiceIdentifier: cfg.Platform.ServiceIdentifier,
+		Interval:          time.Second * time.Duration(cfg.Server.HeartbeatTimeout),
+		FailureThreshold:  cfg.Health.FailureThreshold,
+		RecoveryCooldown:  time.Duration(cfg.Health.RecoveryCooldownSec) * time.Second,
+		SelfDevice: health.SelfDeviceConfig{
+			Enabled:      cfg.Health.SelfDevice.Enabled,
+			DeviceNumber: cfg.Health.SelfDevice.DeviceNumber,
+			DeviceName:   cfg.Health.SelfDevice.DeviceName,
+		},
+	})
+	app.Health.Start()
+
 	// 7. 启动HTTP服务
-	if err := StartHTTPServer(platformClient, cfg.Server.HTTPPort, app.ProtocolHandler); err != nil {
+	server, err := StartHTTPServer(platformClient, &cfg.Server, app.ProtocolHandler, app.SyncManager, app.Health, app.Teardown)
+	if err != nil {
 		app.Shutdown()
 		return nil, err
 	}
+	app.HTTPServer = server
 
 	logrus.Info("服务就绪")
 	return app, nil
@@ -126,6 +140,11 @@ func StartApp(configPath string) (*AppContext, error) {
 
 // initializeProtocol 初始化单协议处理器
 func initializeProtocol(app *AppContext, cfg *config.Config) error {
+	// 加载自定义摄像头模板，失败时仅使用内置模板
+	if err := go2rtc.InitTemplateLibrary(cfg.Camera.TemplatesFile); err != nil {
+		logrus.WithError(err).Warn("加载摄像头模板失败，使用内置模板")
+	}
+
 	// 创建协议处理器
 	// 使用 go2rtc 协议处理器
 	protocolHandler := go2rtc.NewHandler(cfg.Server.Port)
@@ -145,15 +164,159 @@ func initializeProtocol(app *AppContext, cfg *config.Config) error {
 	app.ProtocolHandler = singleHandler
 	logrus.Infof("单协议处理器初始化完成 - %s (v%s)", protocolHandler.Name(), protocolHandler.Version())
 
-	// 启动设备同步服务 (默认30秒同步间隔)
-	syncService := go2rtc.NewDeviceSyncService(
-		protocolHandler,
-		app.PlatformClient,
-		logrus.StandardLogger(),
-		30, // 同步间隔(秒)
-	)
-	syncService.Start()
-	app.SyncService = syncService
+	// 流移除后的下线策略审计日志
+	if err := logger.InitAuditLogger(cfg.Offboard.AuditLog); err != nil {
+		logrus.WithError(err).Warn("初始化审计日志失败，审计记录仅写入主日志")
+	}
+
+	// 按服务接入点启动设备同步服务 (同步间隔与过滤规则取自接入点凭证)
+	opts, err := newSyncOptions(app.PlatformClient, cfg)
+	if err != nil {
+		return err
+	}
+	syncManager := go2rtc.NewSyncManager(app.PlatformClient, logrus.StandardLogger(), opts)
+	syncManager.Start()
+	app.SyncManager = syncManager
+
+	// 处理平台下发的go2rtc指令
+	app.PlatformClient.SetCommandProcessor(go2rtc.NewCommandProcessor(syncManager, logrus.StandardLogger()))
+
+	// 处理看板下发的流控制与平台属性设置，恢复重启前的录像与定时抓图
+	controls := go2rtc.NewControlProcessor(syncManager, opts.Controls, app.PlatformClient, logrus.StandardLogger())
+	controls.Start()
+	app.Controls = controls
+	app.PlatformClient.SetControlProcessor(controls)
+	app.PlatformClient.SetAttributeSetProcessor(controls)
+
+	// 平台删除或断开设备后按策略释放流、录像与设备日志
+	teardownCfg, err := newTeardownConfig(cfg)
+	if err != nil {
+		return err
+	}
+	app.Teardown = go2rtc.NewTeardown(syncManager, controls, app.PlatformClient, logrus.StandardLogger(), teardownCfg)
+
+	// 监听go2rtc配置文件，streams 变化后立即同步
+	if cfg.Sync.Go2RTCConfigFile != "" {
+		watcher, err := go2rtc.NewConfigWatcher(cfg.Sync.Go2RTCConfigFile, logrus.StandardLogger(), func(change go2rtc.StreamsChange) {
+			syncManager.TriggerConfigChanged(cfg.Sync.WatchAccessPoints, change)
+		})
+		if err == nil {
+			err = watcher.Start()
+		}
+		if err != nil {
+			logrus.WithError(err).Warn("监听go2rtc配置文件失败，仅使用定时同步")
+		} else {
+			app.ConfigWatcher = watcher
+		}
+	}
 
 	return nil
 }
+
+// newSyncOptions 按配置创建各接入点共用的同步选项
+func newSyncOptions(platformClient platform.Client, cfg *config.Config) (go2rtc.SyncOptions, error) {
+	// 设备命名模板
+	namer, err := go2rtc.NewDeviceNamer(go2rtc.NamingConfig{
+		ServiceIdentifier: cfg.Platform.ServiceIdentifier,
+		DeviceName:        cfg.Naming.DeviceName,
+		Description:       cfg.Naming.Description,
+		Labels:            cfg.Naming.Labels,
+		Attributes:        cfg.Naming.Attributes,
+		NamePattern:       cfg.Naming.NamePattern,
+	})
+	if err != nil {
+		return go2rtc.SyncOptions{}, err
+	}
+
+	// 流移除后的下线策略
+	offboarder, err := go2rtc.NewOffboarder(platformClient, logrus.StandardLogger(), go2rtc.OffboardConfig{
+		Policy:            go2rtc.OffboardPolicy(cfg.Offboard.Policy),
+		DecommissionAfter: time.Duration(cfg.Offboard.DecommissionAfterDays) * 24 * time.Hour,
+		StateFile:         cfg.Offboard.StateFile,
+	})
+	if err != nil {
+		return go2rtc.SyncOptions{}, err
+	}
+
+	// 看板下发的流控制状态
+	controls, err := go2rtc.NewControlStore(go2rtc.ControlConfig{
+		StateFile:         cfg.Control.StateFile,
+		PlaceholderSource: cfg.Control.PlaceholderSource,
+		RecordingDir:      cfg.Control.RecordingDir,
+		RecordingSegment:  time.Duration(cfg.Control.RecordingSegmentSec) * time.Second,
+		SnapshotDir:       cfg.Control.SnapshotDir,
+	}, logrus.StandardLogger())
+	if err != nil {
+		return go2rtc.SyncOptions{}, err
+	}
+
+	// 已展开通道的NVR，其通道流不作为直连设备同步
+	nvrs, err := go2rtc.NewNVRRegistry(cfg.Camera.NVRStateFile, logrus.StandardLogger())
+	if err != nil {
+		return go2rtc.SyncOptions{}, err
+	}
+
+	return go2rtc.SyncOptions{
+		Namer:      namer,
+		NVRs:       nvrs,
+		Offboarder: offboarder,
+		Controls:   controls,
+		Workers:    cfg.Sync.Workers,
+		Retry: go2rtc.RetryPolicy{
+			MaxRetries:      cfg.Sync.MaxRetries,
+			BaseDelay:       time.Duration(cfg.Sync.RetryBaseDelayMs) * time.Millisecond,
+			MaxDelay:        time.Duration(cfg.Sync.RetryMaxDelayMs) * time.Millisecond,
+			DeadLetterRetry: time.Duration(cfg.Sync.DeadLetterRetrySec) * time.Second,
+		},
+	}, nil
+}
+
+// newTeardownConfig 按配置生成设备清理策略
+func newTeardownConfig(cfg *config.Config) (go2rtc.TeardownConfig, error) {
+	tc := go2rtc.DefaultTeardownConfig()
+	switch cfg.Teardown.Stream {
+	case "", "keep":
+	case "remove":
+		tc.RemoveStream = true
+	default:
+		return tc, fmt.Errorf("不支持的流清理策略: %s", cfg.Teardown.Stream)
+	}
+	switch cfg.Teardown.FinalStatus {
+	case "", "offline":
+	case "none":
+		tc.SendOffline = false
+	default:
+		return tc, fmt.Errorf("不支持的最终状态: %s", cfg.Teardown.FinalStatus)
+	}
+	tc.StopWorkers = !cfg.Teardown.KeepWorkers
+	tc.CloseDeviceLogger = !cfg.Teardown.KeepDeviceLog
+	return tc, nil
+}
+
+// DryRun 按配置访问平台API，预览指定接入点的一轮同步，不产生副作用
+// 只使用HTTP接口，不建立MQTT会话、不重发发件箱，可与运行中的插件同时执行
+// 已同步设备列表只保存在插件进程内存中，命令行预览不包含"流已删除导致下线/停用"的设备；
+// 到期待停用的设备按下线状态文件预览。需要完整预览时使用运行中插件的 /api/v1/sync/dry-run 接口
+func DryRun(configPath, accessPointID string) (*go2rtc.SyncReport, error) {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := InitLogger(&cfg.Log); err != nil {
+		return nil, err
+	}
+	// 报告输出到标准输出，日志改为输出到标准错误
+	logrus.SetOutput(os.Stderr)
+
+	platformClient, err := InitAPIClient(&cfg.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := newSyncOptions(platformClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Info("命令行预览不包含因流已删除而下线或停用的设备，完整预览请调用插件的 /api/v1/sync/dry-run 接口")
+	return go2rtc.NewSyncManager(platformClient, logrus.StandardLogger(), opts).DryRun(accessPointID)
+}
@@ -3,43 +3,69 @@ package bootstrap
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"tp-plugin/internal/config"
 	"tp-plugin/internal/handler"
+	"tp-plugin/internal/health"
 	"tp-plugin/internal/platform"
 	"tp-plugin/internal/protocol"
+	"tp-plugin/internal/protocol/plugins/go2rtc"
 
 	"github.com/sirupsen/logrus"
 )
 
 // StartHTTPServer 启动HTTP服务
-func StartHTTPServer(platformClient *platform.PlatformClient, httpPort int, ph protocol.ProtocolHandler) error {
+// 端口在返回前完成监听，端口被占用时直接返回错误
+func StartHTTPServer(platformClient *platform.PlatformClient, cfg *config.ServerConfig, ph protocol.ProtocolHandler, syncManager *go2rtc.SyncManager, monitor *health.Monitor, teardown *go2rtc.Teardown) (*http.Server, error) {
+	httpPort := cfg.HTTPPort
+
 	// 创建HTTP处理器
 	httpHandler := handler.NewHTTPHandler(platformClient, logrus.StandardLogger(), ph)
+	if syncManager != nil {
+		httpHandler.SetSyncManager(syncManager)
+		httpHandler.SetNVRRegistry(syncManager.NVRs())
+	}
+	if teardown != nil {
+		httpHandler.SetTeardown(teardown)
+	}
 	handlers := httpHandler.RegisterHandlers()
+	diagnostics := handler.NewDiagnosticsHandler(platformClient, syncManager, monitor, logrus.StandardLogger(), cfg.APIToken)
 
-	// 启动HTTP服务
-	go func() {
-		logrus.Infof("启动HTTP服务 [:%d]", httpPort)
+	// 创建自定义处理器来处理URL重写
+	mux := http.NewServeMux()
+
+	// 诊断接口
+	diagnostics.Register(mux)
 
-		// 创建自定义处理器来处理URL重写
-		mux := http.NewServeMux()
+	// 设备列表由适配器直接处理，以支持SDK参数之外的关键字筛选
+	mux.HandleFunc("/api/v1/plugin/device/list", httpHandler.ServeDeviceList)
 
-		// 注册根处理器，并在其中处理URL重写
-		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			// URL重写: /api/v1/notify/event -> /api/v1/plugin/notification
-			if r.URL.Path == "/api/v1/notify/event" {
-				logrus.Debugf("URL Rewriting: %s -> /api/v1/plugin/notification", r.URL.Path)
-				r.URL.Path = "/api/v1/plugin/notification"
-			}
+	// 注册根处理器，并在其中处理URL重写
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// URL重写: /api/v1/notify/event -> /api/v1/plugin/notification
+		if r.URL.Path == "/api/v1/notify/event" {
+			logrus.Debugf("URL Rewriting: %s -> /api/v1/plugin/notification", r.URL.Path)
+			r.URL.Path = "/api/v1/plugin/notification"
+		}
+
+		// 调用SDK处理器
+		handlers.ServeHTTP(w, r)
+	})
 
-			// 调用SDK处理器
-			handlers.ServeHTTP(w, r)
-		})
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", httpPort))
+	if err != nil {
+		return nil, fmt.Errorf("HTTP服务监听失败: %v", err)
+	}
+	server := &http.Server{Handler: mux}
 
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", httpPort), mux); err != nil {
+	// 启动HTTP服务
+	go func() {
+		logrus.Infof("启动HTTP服务 [:%d]", httpPort)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			logrus.Errorf("HTTP服务启动失败: %v", err)
 		}
 	}()
 
-	return nil
+	return server, nil
 }
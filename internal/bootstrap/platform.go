@@ -3,12 +3,16 @@ package bootstrap
 
 import (
 	"fmt"
+	"time"
 	"tp-plugin/internal/config"
 	"tp-plugin/internal/platform"
 
 	"github.com/sirupsen/logrus"
 )
 
+// 未配置时实例ID的保存位置
+const defaultInstanceIDFile = "data/instance_id"
+
 // InitPlatformClient 初始化平台客户端
 func InitPlatformClient(cfg *config.PlatformConfig) (*platform.PlatformClient, error) {
 	// 调试信息
@@ -17,14 +21,39 @@ func InitPlatformClient(cfg *config.PlatformConfig) (*platform.PlatformClient, e
 		"cfg_MQTTBroker": cfg.MQTTBroker,
 	}).Info("平台客户端配置检查")
 
+	// 实例ID决定MQTT客户端ID和自身设备编号，需持久化以在重启和容器重建后保持不变
+	idFile := cfg.InstanceIDFile
+	if idFile == "" {
+		idFile = defaultInstanceIDFile
+	}
+	instanceID, err := platform.LoadInstanceID(cfg.InstanceID, idFile)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("适配器实例ID: %s", instanceID)
+
 	// 简化日志，去掉"正在初始化"的冗余信息
 	platformClient, err := platform.NewPlatformClient(platform.Config{
 		BaseURL:           cfg.URL,
 		MQTTBroker:        cfg.MQTTBroker,
 		MQTTUsername:      cfg.MQTTUsername,
 		MQTTPassword:      cfg.MQTTPassword,
+		MQTTClientID:      cfg.MQTTClientID,
+		InstanceID:        instanceID,
 		ServiceIdentifier: cfg.ServiceIdentifier,
 		TemplateSecret:    cfg.TemplateSecret,
+		SubTemplateSecret: cfg.SubTemplateSecret,
+		AckTimeout:        time.Duration(cfg.AckTimeoutSec) * time.Second,
+		Outbox: platform.OutboxConfig{
+			File:           cfg.Outbox.File,
+			MaxMessages:    cfg.Outbox.MaxMessages,
+			CollapseTopics: cfg.Outbox.CollapseTopics,
+		},
+		DeviceCache: platform.DeviceCacheConfig{
+			TTL:         time.Duration(cfg.DeviceCache.TTLSec) * time.Second,
+			NegativeTTL: time.Duration(cfg.DeviceCache.NegativeTTLSec) * time.Second,
+			MaxEntries:  cfg.DeviceCache.MaxEntries,
+		},
 	}, logrus.StandardLogger())
 
 	if err != nil {
@@ -34,3 +63,23 @@ func InitPlatformClient(cfg *config.PlatformConfig) (*platform.PlatformClient, e
 	logrus.Info("平台客户端就绪")
 	return platformClient, nil
 }
+
+// InitAPIClient 初始化仅API平台客户端
+// 不连接MQTT、不加载发件箱，供 dry-run 等与运行中插件共存的命令使用
+func InitAPIClient(cfg *config.PlatformConfig) (*platform.APIClient, error) {
+	apiClient, err := platform.NewAPIClient(platform.Config{
+		BaseURL:           cfg.URL,
+		ServiceIdentifier: cfg.ServiceIdentifier,
+		TemplateSecret:    cfg.TemplateSecret,
+		SubTemplateSecret: cfg.SubTemplateSecret,
+		DeviceCache: platform.DeviceCacheConfig{
+			TTL:         time.Duration(cfg.DeviceCache.TTLSec) * time.Second,
+			NegativeTTL: time.Duration(cfg.DeviceCache.NegativeTTLSec) * time.Second,
+			MaxEntries:  cfg.DeviceCache.MaxEntries,
+		},
+	}, logrus.StandardLogger())
+	if err != nil {
+		return nil, fmt.Errorf("创建平台API客户端失败: %v", err)
+	}
+	return apiClient, nil
+}
@@ -5,21 +5,52 @@ type Config struct {
 	Server   ServerConfig   `mapstructure:"server"`
 	Platform PlatformConfig `mapstructure:"platform"`
 	Log      LogConfig      `mapstructure:"log"`
+	Camera   CameraConfig   `mapstructure:"camera"`
+	Naming   NamingConfig   `mapstructure:"naming"`
+	Offboard OffboardConfig `mapstructure:"offboard"`
+	Sync     SyncConfig     `mapstructure:"sync"`
+	Control  ControlConfig  `mapstructure:"control"`
+	Health   HealthConfig   `mapstructure:"health"`
+	Teardown TeardownConfig `mapstructure:"teardown"`
 }
 
 type ServerConfig struct {
-	Port             int `mapstructure:"port"`
-	HTTPPort         int `mapstructure:"http_port"`
-	HeartbeatTimeout int `mapstructure:"heartbeatTimeout"`
+	Port             int    `mapstructure:"port"`
+	HTTPPort         int    `mapstructure:"http_port"`
+	HeartbeatTimeout int    `mapstructure:"heartbeatTimeout"`
+	APIToken         string `mapstructure:"api_token"` // 适配器管理接口的访问令牌
 }
 
 type PlatformConfig struct {
-	URL               string `mapstructure:"url"`                // 平台API地址
-	MQTTBroker        string `mapstructure:"mqtt_broker"`        // MQTT服务器地址
-	MQTTUsername      string `mapstructure:"mqtt_username"`      // MQTT用户名
-	MQTTPassword      string `mapstructure:"mqtt_password"`      // MQTT密码
-	ServiceIdentifier string `mapstructure:"service_identifier"` // 服务标识符
-	TemplateSecret    string `mapstructure:"template_secret"`    // 模板密钥，用于动态注册
+	URL               string `mapstructure:"url"`                 // 平台API地址
+	MQTTBroker        string `mapstructure:"mqtt_broker"`         // MQTT服务器地址
+	MQTTUsername      string `mapstructure:"mqtt_username"`       // MQTT用户名
+	MQTTPassword      string `mapstructure:"mqtt_password"`       // MQTT密码
+	MQTTClientID      string `mapstructure:"mqtt_client_id"`      // MQTT客户端ID，为空时使用 服务标识符-实例ID
+	InstanceID        string `mapstructure:"instance_id"`         // 适配器实例ID，为空时读取或生成 instance_id_file
+	InstanceIDFile    string `mapstructure:"instance_id_file"`    // 实例ID持久化文件，默认 data/instance_id
+	ServiceIdentifier string `mapstructure:"service_identifier"`  // 服务标识符
+	TemplateSecret    string `mapstructure:"template_secret"`     // 模板密钥，用于动态注册
+	SubTemplateSecret string `mapstructure:"sub_template_secret"` // 子设备模板密钥，用于NVR通道子设备注册
+
+	AckTimeoutSec int `mapstructure:"ack_timeout_sec"` // 等待平台响应属性、事件上报的时间(秒)，默认10
+
+	Outbox      OutboxConfig      `mapstructure:"outbox"`       // MQTT断线期间的消息暂存
+	DeviceCache DeviceCacheConfig `mapstructure:"device_cache"` // 设备信息缓存
+}
+
+// OutboxConfig MQTT发件箱配置
+type OutboxConfig struct {
+	File           string   `mapstructure:"file"`            // 持久化文件，为空时只保存在内存
+	MaxMessages    int      `mapstructure:"max_messages"`    // 最大消息数，超出时丢弃最早的消息
+	CollapseTopics []string `mapstructure:"collapse_topics"` // 同一主题只保留最新一条的主题前缀，默认 devices/status/
+}
+
+// DeviceCacheConfig 设备信息缓存配置
+type DeviceCacheConfig struct {
+	TTLSec         int `mapstructure:"ttl_sec"`          // 设备信息缓存时间(秒)，默认600
+	NegativeTTLSec int `mapstructure:"negative_ttl_sec"` // 设备不存在的记录缓存时间(秒)，默认30
+	MaxEntries     int `mapstructure:"max_entries"`      // 最多缓存的设备数，默认10000
 }
 
 type LogConfig struct {
@@ -43,3 +74,71 @@ type DeviceLogConfig struct {
 	MaxAge   int    `mapstructure:"max_age"`  // 设备日志文件保留天数
 	Compress bool   `mapstructure:"compress"` // 是否压缩设备日志文件
 }
+
+// CameraConfig 摄像头接入配置
+type CameraConfig struct {
+	TemplatesFile string `mapstructure:"templates_file"` // 自定义品牌取流模板文件，修改后自动生效
+	NVRStateFile  string `mapstructure:"nvr_state_file"` // 已展开通道的NVR记录，{nvr}_ch{N} 流只有在NVR已知时才按通道处理
+}
+
+// NamingConfig 设备命名与元数据模板配置
+// 模板可用字段: ServiceIdentifier StreamName SourceURL SourceScheme SourceHost Codec Fields
+type NamingConfig struct {
+	DeviceName  string            `mapstructure:"device_name"`  // 设备名称模板
+	Description string            `mapstructure:"description"`  // 设备描述模板
+	Labels      []string          `mapstructure:"labels"`       // 标签模板
+	Attributes  map[string]string `mapstructure:"attributes"`   // 初始属性模板
+	NamePattern string            `mapstructure:"name_pattern"` // 流名称解析正则(命名分组作为属性)
+}
+
+// OffboardConfig 流移除后的设备下线策略配置
+type OffboardConfig struct {
+	Policy                string `mapstructure:"policy"`                  // offline(默认) / decommission
+	DecommissionAfterDays int    `mapstructure:"decommission_after_days"` // decommission 策略离线多少天后标记停用
+	StateFile             string `mapstructure:"state_file"`              // 待停用设备记录文件
+	AuditLog              string `mapstructure:"audit_log"`               // 审计日志文件，为空时只写入主日志
+}
+
+// TeardownConfig 平台删除设备或断开连接后的清理策略
+type TeardownConfig struct {
+	Stream        string `mapstructure:"stream"`          // keep(默认): 保留go2rtc流 / remove: 移除流和子码流
+	KeepWorkers   bool   `mapstructure:"keep_workers"`    // 保留录像与定时抓图，默认停止
+	KeepDeviceLog bool   `mapstructure:"keep_device_log"` // 保留设备日志文件，默认关闭
+	FinalStatus   string `mapstructure:"final_status"`    // offline(默认): 上报离线状态 / none: 不上报
+}
+
+// ControlConfig 看板下发的流控制配置
+type ControlConfig struct {
+	StateFile           string `mapstructure:"state_file"`            // 控制状态文件，保证重启后设置仍然生效
+	PlaceholderSource   string `mapstructure:"placeholder_source"`    // 隐私模式下替换的go2rtc源地址
+	RecordingDir        string `mapstructure:"recording_dir"`         // 录像目录，为空时不支持录像
+	RecordingSegmentSec int    `mapstructure:"recording_segment_sec"` // 单个录像文件时长(秒)，默认600
+	SnapshotDir         string `mapstructure:"snapshot_dir"`          // 定时抓图目录，为空时不支持定时抓图
+}
+
+// SyncConfig 设备同步并发与重试配置
+type SyncConfig struct {
+	Workers            int `mapstructure:"workers"`               // 并发注册的设备数
+	MaxRetries         int `mapstructure:"max_retries"`           // 单设备注册失败后的最大重试次数，-1表示不重试
+	RetryBaseDelayMs   int `mapstructure:"retry_base_delay_ms"`   // 首次重试等待时间(毫秒)，之后指数增长并带随机抖动
+	RetryMaxDelayMs    int `mapstructure:"retry_max_delay_ms"`    // 单次重试等待上限(毫秒)
+	DeadLetterRetrySec int `mapstructure:"dead_letter_retry_sec"` // 死信设备再次尝试的间隔(秒)
+
+	// 与go2rtc同机部署时监听其配置文件，streams 变化后立即同步，定时同步仍作为兜底
+	Go2RTCConfigFile  string   `mapstructure:"go2rtc_config_file"`  // go2rtc.yaml 路径，为空时不监听
+	WatchAccessPoints []string `mapstructure:"watch_access_points"` // 需要触发同步的接入点ID，为空时为go2rtc地址指向本机的接入点
+}
+
+// HealthConfig 心跳失败恢复与适配器自身设备配置
+type HealthConfig struct {
+	FailureThreshold    int              `mapstructure:"failure_threshold"`     // 心跳连续失败多少次后执行恢复，默认3
+	RecoveryCooldownSec int              `mapstructure:"recovery_cooldown_sec"` // 两次恢复的最小间隔(秒)，默认300
+	SelfDevice          SelfDeviceConfig `mapstructure:"self_device"`
+}
+
+// SelfDeviceConfig 适配器自身在平台上的设备，用于上报健康状态
+type SelfDeviceConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	DeviceNumber string `mapstructure:"device_number"` // 为空时使用 服务标识符-adapter-实例ID
+	DeviceName   string `mapstructure:"device_name"`   // 为空时与设备编号相同
+}
@@ -0,0 +1,338 @@
+package e2e
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tp-plugin/internal/bootstrap"
+	"tp-plugin/internal/platform"
+	"tp-plugin/internal/platform/platformtest"
+	"tp-plugin/internal/protocol/plugins/go2rtc/go2rtctest"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	serviceIdentifier = "GO2RTC"
+	templateSecret    = "e2e-secret"
+	accessPointID     = "ap-e2e"
+	placeholderSource = "ffmpeg:virtual?video=color#video=h264"
+	selfDeviceNumber  = "adapter-e2e"
+)
+
+// Message 适配器发布到MQTT的一条消息
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// harness 在同一进程内运行嵌入式MQTT服务、模拟平台API、模拟go2rtc和适配器
+// 适配器上报的遥测、属性、事件和状态解码后记录到 Platform，属性与事件自动回复成功
+type harness struct {
+	t        *testing.T
+	broker   *mqtt.Server
+	api      *platformtest.APIServer
+	platform *platformtest.Platform
+	go2rtc   *go2rtctest.Server
+	app      *bootstrap.AppContext
+	httpURL  string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// newHarness 启动全部依赖，streams 为go2rtc中预置的流(流名称 -> 源地址)
+// 适配器启动前写入，首轮同步即可注册
+func newHarness(t *testing.T, streams map[string]string) *harness {
+	t.Helper()
+
+	h := &harness{t: t, platform: platformtest.New()}
+
+	h.go2rtc = go2rtctest.NewServer()
+	t.Cleanup(h.go2rtc.Close)
+	for name, source := range streams {
+		h.go2rtc.AddStream(name, source)
+	}
+
+	h.platform.SetAccessPoints(types.ServiceAccessRsp{
+		ID:      accessPointID,
+		Name:    "e2e",
+		Voucher: string(mustJSON(t, map[string]interface{}{"api_url": h.go2rtc.URL, "sync_interval": 1})),
+	})
+	h.api = platformtest.NewAPIServer(h.platform)
+	h.api.RequireTemplateSecret(templateSecret)
+	t.Cleanup(h.api.Close)
+
+	brokerAddr := h.startBroker()
+
+	httpPort := freePort(t)
+	h.httpURL = fmt.Sprintf("http://127.0.0.1:%d", httpPort)
+	configPath := h.writeConfig(brokerAddr, httpPort)
+
+	app, err := bootstrap.StartApp(configPath)
+	if err != nil {
+		t.Fatalf("启动适配器失败: %v", err)
+	}
+	h.app = app
+	t.Cleanup(app.Shutdown)
+	// StartApp 按配置设置全局日志，测试中只输出警告以上
+	logrus.SetLevel(logrus.WarnLevel)
+
+	eventually(t, 5*time.Second, "适配器连接MQTT", func() bool {
+		return h.app.PlatformClient.ConnectionStatus().State == platform.ConnStateConnected
+	})
+	return h
+}
+
+// startBroker 启动只监听本机的MQTT服务，返回监听地址
+func (h *harness) startBroker() string {
+	t := h.t
+	t.Helper()
+
+	broker := mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("添加MQTT认证钩子失败: %v", err)
+	}
+	listener := listeners.NewTCP(listeners.Config{ID: "e2e", Address: "127.0.0.1:0"})
+	if err := broker.AddListener(listener); err != nil {
+		t.Fatalf("MQTT监听失败: %v", err)
+	}
+	go broker.Serve()
+	t.Cleanup(func() { broker.Close() })
+	h.broker = broker
+
+	if err := broker.Subscribe("devices/#", 1, h.onUplink); err != nil {
+		t.Fatalf("订阅上行主题失败: %v", err)
+	}
+	return listener.Address()
+}
+
+// writeConfig 生成适配器配置，状态文件写入临时目录
+func (h *harness) writeConfig(brokerAddr string, httpPort int) string {
+	t := h.t
+	t.Helper()
+
+	dir := t.TempDir()
+	config := fmt.Sprintf(`server:
+  port: %d
+  http_port: %d
+  heartbeatTimeout: 1
+platform:
+  url: %q
+  mqtt_broker: "tcp://%s"
+  mqtt_client_id: "e2e-adapter"
+  instance_id: "e2e"
+  service_identifier: %q
+  template_secret: %q
+  ack_timeout_sec: 5
+control:
+  state_file: %q
+  placeholder_source: %q
+offboard:
+  policy: "offline"
+  state_file: %q
+health:
+  failure_threshold: 2
+  recovery_cooldown_sec: 1
+  self_device:
+    enabled: true
+    device_number: %q
+teardown:
+  stream: "remove"
+log:
+  level: "warn"
+  enableFile: false
+`,
+		freePort(t), httpPort,
+		h.api.URL, brokerAddr, serviceIdentifier, templateSecret,
+		filepath.Join(dir, "controls.json"), placeholderSource,
+		filepath.Join(dir, "offboard.json"), selfDeviceNumber,
+	)
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+	return path
+}
+
+// onUplink 解码适配器的上行消息
+// 主题格式错误或 values 无法解码时直接使测试失败，用于发现主题与格式的回归
+func (h *harness) onUplink(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+	topic := pk.TopicName
+	payload := append([]byte(nil), pk.Payload...)
+
+	h.mu.Lock()
+	h.messages = append(h.messages, Message{Topic: topic, Payload: payload})
+	h.mu.Unlock()
+
+	parts := strings.Split(topic, "/")
+	switch {
+	case topic == "devices/telemetry":
+		deviceID, values := h.decodeValues(topic, payload)
+		h.platform.SendTelemetry(deviceID, values)
+	case len(parts) == 3 && parts[1] == "status":
+		status := 0
+		if string(payload) == "1" {
+			status = 1
+		}
+		h.platform.SendDeviceStatus(parts[2], status)
+	case len(parts) == 3 && parts[1] == "attributes":
+		deviceID, values := h.decodeValues(topic, payload)
+		h.platform.SendAttributes(deviceID, values)
+		h.ack("attributes", deviceID, parts[2])
+	case len(parts) == 3 && parts[1] == "event":
+		deviceID, values := h.decodeValues(topic, payload)
+		method, _ := values["method"].(string)
+		params, _ := values["params"].(map[string]interface{})
+		h.platform.SendEvent(deviceID, method, params)
+		h.ack("event", deviceID, parts[2])
+	}
+}
+
+// decodeValues 解析 {"device_id": ..., "values": base64(json)}
+func (h *harness) decodeValues(topic string, payload []byte) (string, map[string]interface{}) {
+	var msg struct {
+		DeviceID string `json:"device_id"`
+		Values   string `json:"values"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		h.t.Errorf("%s 消息格式错误: %v", topic, err)
+		return "", nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(msg.Values)
+	if err != nil {
+		h.t.Errorf("%s 的 values 不是base64: %v", topic, err)
+		return msg.DeviceID, nil
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		h.t.Errorf("%s 的 values 不是JSON: %v", topic, err)
+	}
+	return msg.DeviceID, values
+}
+
+// ack 以平台身份回复属性、事件上报
+// 在回调中直接发布会阻塞服务端的消息分发，放到单独的goroutine
+func (h *harness) ack(kind, deviceID, messageID string) {
+	topic := fmt.Sprintf("plugin/%s/devices/%s/response/%s/%s", serviceIdentifier, kind, deviceID, messageID)
+	go h.broker.Publish(topic, []byte(`{"result":0,"message":"success"}`), false, 1)
+}
+
+// publish 以平台身份下发消息
+func (h *harness) publish(topic string, v interface{}) {
+	h.t.Helper()
+	if err := h.broker.Publish(topic, mustJSON(h.t, v), false, 1); err != nil {
+		h.t.Fatalf("发布 %s 失败: %v", topic, err)
+	}
+}
+
+// waitMessage 等待适配器发布指定主题的消息
+func (h *harness) waitMessage(topic string) Message {
+	h.t.Helper()
+	var found Message
+	eventually(h.t, 5*time.Second, "等待消息 "+topic, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, msg := range h.messages {
+			if msg.Topic == topic {
+				found = msg
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// hasMessage 适配器是否已发布指定主题的消息
+func (h *harness) hasMessage(topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, msg := range h.messages {
+		if msg.Topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// waitDevice 等待设备注册到平台
+func (h *harness) waitDevice(deviceNumber string) *types.Device {
+	h.t.Helper()
+	var device *types.Device
+	eventually(h.t, 5*time.Second, "等待设备注册 "+deviceNumber, func() bool {
+		d, ok := h.platform.Device(deviceNumber)
+		device = d
+		return ok
+	})
+	return device
+}
+
+// getJSON 请求适配器HTTP接口，解析 data 字段，返回状态码
+func (h *harness) getJSON(path string, data interface{}) int {
+	h.t.Helper()
+	resp, err := http.Get(h.httpURL + path)
+	if err != nil {
+		h.t.Fatalf("请求 %s 失败: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		h.t.Fatalf("解析 %s 响应失败: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+// eventually 在超时前反复检查条件
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("超时: %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("分配端口失败: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
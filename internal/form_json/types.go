@@ -1,8 +1,89 @@
 package formjson
 
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// FlexInt 兼容表单以数字或字符串提交的整数，空字符串视为0
+type FlexInt int
+
+// UnmarshalJSON 实现 json.Unmarshaler
+func (f *FlexInt) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			*f = 0
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*f = FlexInt(n)
+		return nil
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = FlexInt(n)
+	return nil
+}
+
 // SVCRForm 服务接入点凭证表单结构
 type SVCRForm struct {
-	APIURL       string `json:"api_url"`
-	SyncInterval int    `json:"sync_interval"`
-	AutoSync     bool   `json:"auto_sync"`
+	APIURL       string  `json:"api_url"`
+	Username     string  `json:"username"` // go2rtc API 的 Basic 认证，未开启认证时留空
+	Password     string  `json:"password"`
+	SyncInterval FlexInt `json:"sync_interval"`
+	AutoSync     *bool   `json:"auto_sync"`    // 未填写时视为开启
+	Include      string  `json:"include"`      // 包含规则，逗号或换行分隔
+	Exclude      string  `json:"exclude"`      // 排除规则，逗号或换行分隔
+	Marker       string  `json:"marker"`       // 只同步名称以该标记开头的流
+	SkipAliases  *bool   `json:"skip_aliases"` // 跳过转码别名流，未填写时视为开启
+}
+
+// AutoSyncEnabled 是否启用自动同步
+func (f SVCRForm) AutoSyncEnabled() bool {
+	return f.AutoSync == nil || *f.AutoSync
+}
+
+// SkipAliasesEnabled 是否跳过转码别名流
+func (f SVCRForm) SkipAliasesEnabled() bool {
+	return f.SkipAliases == nil || *f.SkipAliases
+}
+
+// NVRVoucher NVR网关设备凭证表单结构
+type NVRVoucher struct {
+	Host         string  `json:"host"`
+	Port         FlexInt `json:"port"`
+	Username     string  `json:"username"`
+	Password     string  `json:"password"`
+	Brand        string  `json:"brand"`
+	ChannelCount FlexInt `json:"channel_count"`
+}
+
+// CameraVoucher 摄像头直连设备凭证表单结构
+// 填写 stream_url 时直接使用；否则按品牌模板渲染取流地址
+type CameraVoucher struct {
+	StreamURL      string  `json:"stream_url"`
+	StreamName     string  `json:"stream_name"`
+	Brand          string  `json:"brand"`
+	Host           string  `json:"host"`
+	Port           FlexInt `json:"port"`
+	CameraUsername string  `json:"camera_username"`
+	CameraPassword string  `json:"camera_password"`
+	Channel        FlexInt `json:"channel"`
+	StreamType     string  `json:"stream_type"` // main/sub
 }
@@ -0,0 +1,290 @@
+// internal/handler/diagnostics.go
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/handler"
+	"github.com/sirupsen/logrus"
+
+	"tp-plugin/internal/health"
+	"tp-plugin/internal/pkg/metrics"
+	"tp-plugin/internal/platform"
+	"tp-plugin/internal/protocol/plugins/go2rtc"
+)
+
+// DiagnosticsHandler 适配器自身的诊断与管理接口
+// 配置了访问令牌时全部接口都需要认证；会触发操作的接口在未配置令牌时禁用
+type DiagnosticsHandler struct {
+	platform    *platform.PlatformClient
+	syncManager *go2rtc.SyncManager
+	health      *health.Monitor
+	logger      *logrus.Logger
+	token       string
+}
+
+// NewDiagnosticsHandler 创建诊断接口处理器
+func NewDiagnosticsHandler(platform *platform.PlatformClient, syncManager *go2rtc.SyncManager, monitor *health.Monitor, logger *logrus.Logger, token string) *DiagnosticsHandler {
+	return &DiagnosticsHandler{
+		platform:    platform,
+		syncManager: syncManager,
+		health:      monitor,
+		logger:      logger,
+		token:       token,
+	}
+}
+
+// Register 注册诊断接口路由
+func (d *DiagnosticsHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/metrics", d.auth(false, metrics.Handler().ServeHTTP))
+	mux.HandleFunc("/api/v1/diagnostics/health", d.auth(false, d.handleHealth))
+	mux.HandleFunc("/api/v1/diagnostics/mqtt", d.auth(false, d.handleMQTT))
+	mux.HandleFunc("/api/v1/diagnostics/outbox", d.auth(false, d.handleOutbox))
+	mux.HandleFunc("/api/v1/diagnostics/device-cache", d.auth(false, d.handleDeviceCache))
+	mux.HandleFunc("/api/v1/diagnostics/dead-letters", d.auth(false, d.handleDeadLetters))
+	mux.HandleFunc("/api/v1/sync/dry-run", d.auth(false, d.handleDryRun))
+	mux.HandleFunc("/api/v1/sync/trigger", d.auth(true, d.handleTrigger))
+	mux.HandleFunc("/api/v1/sync/job", d.auth(false, d.handleJob))
+	mux.HandleFunc("/api/v1/sync/status", d.auth(false, d.handleStatus))
+	mux.HandleFunc("/api/v1/sync/reload", d.auth(false, d.handleReload))
+}
+
+// auth 校验访问令牌
+// 令牌通过 Authorization: Bearer <token> 或 X-API-Token 请求头传递
+// mutating 为true的接口在未配置令牌时拒绝访问
+func (d *DiagnosticsHandler) auth(mutating bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d.token == "" {
+			if mutating {
+				writeJSON(w, http.StatusForbidden, "未配置 server.api_token，接口已禁用", nil)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		token := r.Header.Get("X-API-Token")
+		if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+			token = strings.TrimPrefix(bearer, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+			d.logger.Warnf("管理接口认证失败: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, "unauthorized", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleHealth 适配器健康状态汇总，平台心跳连续失败时返回503
+func (d *DiagnosticsHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if d.health == nil {
+		writeJSON(w, http.StatusServiceUnavailable, "健康监控未启动", nil)
+		return
+	}
+
+	summary := d.health.Summary()
+	if summary.Status == health.StatusDown {
+		writeJSON(w, http.StatusServiceUnavailable, summary.Status, summary)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary.Status, summary)
+}
+
+// handleMQTT MQTT连接状态
+func (d *DiagnosticsHandler) handleMQTT(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", d.platform.ConnectionStatus())
+}
+
+// handleOutbox MQTT发件箱状态
+func (d *DiagnosticsHandler) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", d.platform.OutboxStats())
+}
+
+// handleDeviceCache 设备信息缓存统计
+func (d *DiagnosticsHandler) handleDeviceCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", d.platform.DeviceCacheStats())
+}
+
+// handleDeadLetters 多次重试仍同步失败的设备
+// 可用 access_point_id 参数只查看指定接入点
+func (d *DiagnosticsHandler) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if d.syncManager == nil {
+		writeJSON(w, http.StatusOK, "success", []go2rtc.DeadLetter{})
+		return
+	}
+
+	accessPointID := r.URL.Query().Get("access_point_id")
+	if accessPointID == "" {
+		writeJSON(w, http.StatusOK, "success", d.syncManager.DeadLetters())
+		return
+	}
+
+	service, ok := d.syncManager.GetService(accessPointID)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, "接入点不存在或未启用自动同步", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", service.DeadLetters())
+}
+
+// handleDryRun 预览指定接入点的一轮同步，不注册设备、不发送状态
+func (d *DiagnosticsHandler) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	accessPointID := r.URL.Query().Get("access_point_id")
+	if accessPointID == "" {
+		writeJSON(w, http.StatusBadRequest, "缺少参数 access_point_id", nil)
+		return
+	}
+	if d.syncManager == nil {
+		writeJSON(w, http.StatusServiceUnavailable, "设备同步服务未启动", nil)
+		return
+	}
+
+	report, err := d.syncManager.DryRun(accessPointID)
+	if err != nil {
+		d.logger.WithError(err).Warnf("同步预览失败: %s", accessPointID)
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", report)
+}
+
+// handleTrigger 立即触发指定接入点的同步，返回任务ID
+func (d *DiagnosticsHandler) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	accessPointID := r.URL.Query().Get("access_point_id")
+	if accessPointID == "" {
+		writeJSON(w, http.StatusBadRequest, "缺少参数 access_point_id", nil)
+		return
+	}
+	if d.syncManager == nil {
+		writeJSON(w, http.StatusServiceUnavailable, "设备同步服务未启动", nil)
+		return
+	}
+
+	job, err := d.syncManager.Trigger(accessPointID)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	d.logger.WithFields(logrus.Fields{
+		"access_point": accessPointID,
+		"job":          job.ID,
+		"remote":       r.RemoteAddr,
+	}).Info("收到手动同步请求")
+	writeJSON(w, http.StatusOK, "success", job)
+}
+
+// handleJob 查询手动同步任务
+func (d *DiagnosticsHandler) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, "缺少参数 id", nil)
+		return
+	}
+	if d.syncManager == nil {
+		writeJSON(w, http.StatusNotFound, "任务不存在", nil)
+		return
+	}
+
+	job, ok := d.syncManager.Job(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, "任务不存在", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", job)
+}
+
+// handleStatus 接入点同步状态
+// 可用 access_point_id 参数只查看指定接入点
+func (d *DiagnosticsHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if d.syncManager == nil {
+		writeJSON(w, http.StatusOK, "success", []go2rtc.SyncStatus{})
+		return
+	}
+
+	accessPointID := r.URL.Query().Get("access_point_id")
+	if accessPointID == "" {
+		writeJSON(w, http.StatusOK, "success", d.syncManager.Statuses())
+		return
+	}
+
+	service, ok := d.syncManager.GetService(accessPointID)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, "接入点不存在或未启用自动同步", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", service.Status())
+}
+
+// handleReload 最近一次接入点重新加载的结果，用于确认服务配置修改是否生效
+func (d *DiagnosticsHandler) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+	if d.syncManager == nil {
+		writeJSON(w, http.StatusNotFound, "接入点同步未启动", nil)
+		return
+	}
+	result, ok := d.syncManager.LastReload()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, "接入点尚未加载", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", result)
+}
+
+// writeJSON 按SDK通用响应结构输出JSON
+func writeJSON(w http.ResponseWriter, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if code != http.StatusOK {
+		w.WriteHeader(code)
+	}
+	resp := handler.CommonResponse{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logrus.WithError(err).Warn("写入响应失败")
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	formjson "tp-plugin/internal/form_json"
 	"tp-plugin/internal/pkg/logger"
 	"tp-plugin/internal/platform"
@@ -44,14 +47,23 @@ func (w *logrusWriter) Write(p []byte) (n int, err error) {
 
 // HTTPHandler HTTP服务处理器
 type HTTPHandler struct {
-	platform        *platform.PlatformClient
+	platform        platform.Client
 	logger          *logrus.Logger
 	stdlog          *log.Logger
 	protocolHandler protocol.ProtocolHandler
+	nvrs            *go2rtc.NVRRegistry // 已知的NVR，设备列表中不显示其通道流
+
+	// 无法按接入点确定go2rtc时，设备配置通知使用的go2rtc客户端(启动时的配置)
+	streamMu   sync.RWMutex
+	streams    *go2rtc.Go2RTCProtocolHandler
+	nvrManager *go2rtc.NVRManager
+
+	syncManager *go2rtc.SyncManager // 为nil时设备配置通知总是使用共用的go2rtc客户端
+	teardown    *go2rtc.Teardown    // 为nil时设备断开只清除缓存
 }
 
 // NewHTTPHandler 创建HTTP处理器
-func NewHTTPHandler(platform *platform.PlatformClient, logger *logrus.Logger, ph protocol.ProtocolHandler) *HTTPHandler {
+func NewHTTPHandler(platform platform.Client, logger *logrus.Logger, ph protocol.ProtocolHandler) *HTTPHandler {
 	// 创建适配器
 	writer := &logrusWriter{
 		logger: logger,
@@ -61,12 +73,75 @@ func NewHTTPHandler(platform *platform.PlatformClient, logger *logrus.Logger, ph
 	// 不使用标准库的前缀，因为我们会在写入时添加
 	stdlog := log.New(writer, "", 0)
 
-	return &HTTPHandler{
+	h := &HTTPHandler{
 		platform:        platform,
 		logger:          logger,
 		stdlog:          stdlog,
 		protocolHandler: ph,
 	}
+	if gh := h.go2rtcHandler(); gh != nil {
+		h.setStreamHandler(gh)
+	}
+	return h
+}
+
+// SetNVRRegistry 设置与同步服务共用的NVR记录
+func (h *HTTPHandler) SetNVRRegistry(r *go2rtc.NVRRegistry) {
+	h.nvrs = r
+	if gh, _ := h.streamHandler(); gh != nil {
+		h.setStreamHandler(gh)
+	}
+}
+
+// setStreamHandler 替换设备配置通知使用的go2rtc客户端，并按其重建NVR通道管理器
+func (h *HTTPHandler) setStreamHandler(gh *go2rtc.Go2RTCProtocolHandler) {
+	nvrManager := go2rtc.NewNVRManager(gh, h.platform, h.nvrs, h.logger)
+	h.streamMu.Lock()
+	h.streams = gh
+	h.nvrManager = nvrManager
+	h.streamMu.Unlock()
+}
+
+// streamHandler 获取设备配置通知使用的go2rtc客户端和NVR通道管理器，非go2rtc协议时返回nil
+func (h *HTTPHandler) streamHandler() (*go2rtc.Go2RTCProtocolHandler, *go2rtc.NVRManager) {
+	h.streamMu.RLock()
+	defer h.streamMu.RUnlock()
+	return h.streams, h.nvrManager
+}
+
+// SetSyncManager 设置接入点同步管理器，用于服务配置修改通知
+func (h *HTTPHandler) SetSyncManager(m *go2rtc.SyncManager) {
+	h.syncManager = m
+}
+
+// SetTeardown 设置设备清理策略，用于平台删除或断开设备
+func (h *HTTPHandler) SetTeardown(t *go2rtc.Teardown) {
+	h.teardown = t
+}
+
+// deviceStreamHandler 选择设备配置通知中的流应写入的go2rtc客户端
+// 优先使用设备所属接入点的客户端，无法确定时使用共用的客户端
+func (h *HTTPHandler) deviceStreamHandler(deviceID, streamName string) *go2rtc.Go2RTCProtocolHandler {
+	if h.syncManager != nil {
+		if gh, ok := h.syncManager.DeviceHandler(deviceID, streamName); ok {
+			return gh
+		}
+	}
+	gh, _ := h.streamHandler()
+	return gh
+}
+
+// go2rtcHandler 获取底层go2rtc协议处理器，非go2rtc协议时返回nil
+func (h *HTTPHandler) go2rtcHandler() *go2rtc.Go2RTCProtocolHandler {
+	if g, ok := h.protocolHandler.(*go2rtc.Go2RTCProtocolHandler); ok {
+		return g
+	}
+	if sph, ok := h.protocolHandler.(*protocol.SingleProtocolHandler); ok {
+		if g, ok := sph.GetHandler().(*go2rtc.Go2RTCProtocolHandler); ok {
+			return g
+		}
+	}
+	return nil
 }
 
 // RegisterHandlers 注册所有HTTP处理器
@@ -104,7 +179,10 @@ func (h *HTTPHandler) handleGetFormConfig(req *handler.GetFormConfigRequest) (in
 	case "CFG": // 设备配置表单
 		return nil, nil
 	case "VCR": // 设备凭证表单
-		return nil, nil
+		if req.DeviceType == "2" { // 网关设备按NVR处理
+			return withBrandOptions(readFormConfigByPath("internal/form_json/form_nvr_voucher.json")), nil
+		}
+		return withBrandOptions(readFormConfigByPath("internal/form_json/form_voucher.json")), nil
 	case "SVCR": // 服务接入点凭证表单
 		return readFormConfigByPath("internal/form_json/form_service_voucher.json"), nil
 	default:
@@ -133,24 +211,69 @@ func readFormConfigByPath(path string) interface{} {
 	}
 }
 
+// withBrandOptions 用当前模板库填充表单中品牌(brand)下拉选项
+// 表单中值为空的选项(如自定义地址)会保留在最前面
+func withBrandOptions(form interface{}) interface{} {
+	items, ok := form.([]interface{})
+	if !ok {
+		return form
+	}
+
+	for _, item := range items {
+		field, ok := item.(map[string]interface{})
+		if !ok || field["dataKey"] != "brand" {
+			continue
+		}
+
+		options := []interface{}{}
+		if existing, ok := field["options"].([]interface{}); ok {
+			for _, opt := range existing {
+				if o, ok := opt.(map[string]interface{}); ok && o["value"] == "" {
+					options = append(options, o)
+				}
+			}
+		}
+		for _, t := range go2rtc.ListURLTemplates() {
+			options = append(options, map[string]interface{}{
+				"label": t.Label,
+				"value": t.Brand,
+			})
+		}
+		field["options"] = options
+	}
+	return form
+}
+
+// resolveCameraStreamURL 根据摄像头凭证得到go2rtc源地址
+// 优先使用 stream_url，否则按品牌模板渲染；两者都未填写时返回空
+func resolveCameraStreamURL(camera formjson.CameraVoucher) (string, error) {
+	if camera.StreamURL != "" {
+		return camera.StreamURL, nil
+	}
+	if camera.Brand == "" {
+		return "", nil
+	}
+	return go2rtc.RenderStreamURL(camera.Brand, go2rtc.URLParams{
+		Host:     camera.Host,
+		Port:     int(camera.Port),
+		Username: camera.CameraUsername,
+		Password: camera.CameraPassword,
+		Channel:  int(camera.Channel),
+		Stream:   camera.StreamType,
+	})
+}
+
 // handleDeviceDisconnect 处理设备断开连接请求
 func (h *HTTPHandler) handleDeviceDisconnect(req *handler.DeviceDisconnectRequest) error {
 	h.logger.WithField("device_id", req.DeviceID).Info("收到设备断开连接请求")
 
-	// 清理设备缓存
-	// Note: 因为原缓存是按 device_number 存储的,这里要先查出设备信息
-	device, err := h.platform.GetDeviceByID(req.DeviceID)
-	if err == nil { // 如果能找到设备就清理缓存
-		h.platform.ClearDeviceCache(device.DeviceNumber)
+	// 按策略清理流、录像与设备日志，需要在清除缓存前查找设备对应的流
+	if h.teardown != nil {
+		h.teardown.Device(req.DeviceID, "platform_disconnect")
 	}
 
-	// 发送设备离线状态
-	// err = h.platform.SendDeviceStatus(req.DeviceID, platform.DeviceStatusOffline)
-	// if err != nil {
-	// 	h.logger.WithError(err).Error("发送设备离线状态失败")
-	// 	return err
-	// }
-
+	// 清理设备缓存
+	h.platform.ClearDeviceCacheByID(req.DeviceID)
 	return nil
 }
 
@@ -172,7 +295,8 @@ func (h *HTTPHandler) handleNotification(req *handler.NotificationRequest) error
 	switch req.MessageType {
 	case "1": // 服务配置修改
 		h.logger.Info("处理服务配置修改通知")
-		// TODO: 实现服务配置修改逻辑
+		accessPointID, _ := msgData["service_access_id"].(string)
+		h.handleServiceConfig(accessPointID)
 	case "2": // 设备配置修改
 		h.logger.Info("处理设备配置修改通知")
 		// device_id is in the message
@@ -182,7 +306,8 @@ func (h *HTTPHandler) handleNotification(req *handler.NotificationRequest) error
 			return nil
 		}
 
-		// 获取设备信息
+		// 设备配置已修改，丢弃缓存后重新获取
+		h.platform.ClearDeviceCacheByID(deviceID)
 		device, err := h.platform.GetDeviceByID(deviceID)
 		if err != nil {
 			h.logger.WithError(err).Warnf("获取设备信息失败: %s", deviceID)
@@ -194,36 +319,40 @@ func (h *HTTPHandler) handleNotification(req *handler.NotificationRequest) error
 		if device.Voucher != "" {
 			var voucher map[string]interface{}
 			if err := json.Unmarshal([]byte(device.Voucher), &voucher); err == nil {
-				streamURL, _ := voucher["stream_url"].(string)
+				// NVR网关凭证，按通道展开
+				if _, isNVR := voucher["channel_count"]; isNVR {
+					h.handleNVRConfig(device.DeviceNumber, device.Voucher)
+					return nil
+				}
+
+				var camera formjson.CameraVoucher
+				if err := json.Unmarshal([]byte(device.Voucher), &camera); err != nil {
+					h.logger.WithError(err).Warnf("解析摄像头凭证失败: %s", device.DeviceNumber)
+					return nil
+				}
+
+				streamURL, err := resolveCameraStreamURL(camera)
+				if err != nil {
+					h.logger.WithError(err).Warnf("生成取流地址失败: %s", device.DeviceNumber)
+					return nil
+				}
 				if streamURL != "" {
-					streamName, _ := voucher["stream_name"].(string)
+					streamName := camera.StreamName
 					if streamName == "" {
 						streamName = device.DeviceNumber
 					}
 
 					// Call go2rtc handler
-					var gh *go2rtc.Go2RTCProtocolHandler
-
-					// Try to cast to Go2RTCProtocolHandler directly
-					if g, ok := h.protocolHandler.(*go2rtc.Go2RTCProtocolHandler); ok {
-						gh = g
-					} else if sph, ok := h.protocolHandler.(*protocol.SingleProtocolHandler); ok {
-						// Try to unwrap from SingleProtocolHandler
-						if g, ok := sph.GetHandler().(*go2rtc.Go2RTCProtocolHandler); ok {
-							gh = g
-						}
-					}
-
-					if gh != nil {
+					if gh := h.deviceStreamHandler(deviceID, streamName); gh != nil {
 						// Add stream
 						if err := gh.AddStream(streamName, streamURL); err != nil {
 							h.logger.WithError(err).Errorf("Adding stream failed: %s", streamName)
 						} else {
 							h.logger.Infof("Updated stream: %s -> %s", streamName, streamURL)
 						}
+					} else {
+						h.logger.Warn("Protocol handler is not go2rtc handler")
 					}
-				} else {
-					h.logger.Warn("Protocol handler is not go2rtc handler")
 				}
 			} else {
 				h.logger.WithError(err).Warnf("解析凭证失败: %s", device.Voucher)
@@ -236,13 +365,89 @@ func (h *HTTPHandler) handleNotification(req *handler.NotificationRequest) error
 	return nil
 }
 
+// handleServiceConfig 服务接入点配置修改后重建go2rtc客户端和同步服务
+// 设备配置通知按设备所属接入点选择go2rtc客户端，随同步服务一同更新，不修改共用的客户端
+func (h *HTTPHandler) handleServiceConfig(accessPointID string) {
+	if h.syncManager == nil {
+		h.logger.Warn("接入点同步未启动，忽略服务配置修改")
+		return
+	}
+
+	result, err := h.syncManager.ApplyServiceConfig(accessPointID)
+	if err != nil {
+		return
+	}
+	h.logger.WithFields(logrus.Fields{
+		"access_point": accessPointID,
+		"created":      result.Created,
+		"rebuilt":      result.Rebuilt,
+		"disabled":     result.Disabled,
+		"removed":      result.Removed,
+		"failed":       result.Failed,
+	}).Info("服务配置修改已应用")
+}
+
+// handleNVRConfig 处理NVR网关设备配置，按通道数展开流和子设备
+func (h *HTTPHandler) handleNVRConfig(nvrNumber string, rawVoucher string) {
+	_, nvrManager := h.streamHandler()
+	if nvrManager == nil {
+		h.logger.Warn("Protocol handler is not go2rtc handler")
+		return
+	}
+
+	var voucher formjson.NVRVoucher
+	if err := json.Unmarshal([]byte(rawVoucher), &voucher); err != nil {
+		h.logger.WithError(err).Warnf("解析NVR凭证失败: %s", nvrNumber)
+		return
+	}
+
+	if err := nvrManager.SyncNVR(nvrNumber, voucher); err != nil {
+		h.logger.WithError(err).Errorf("NVR通道同步失败: %s", nvrNumber)
+	}
+}
+
 // handleGetDeviceList 处理获取设备列表请求
 func (h *HTTPHandler) handleGetDeviceList(req *handler.GetDeviceListRequest) (*handler.DeviceListResponse, error) {
+	return h.deviceList(req, "")
+}
+
+// ServeDeviceList 设备列表接口，在SDK的参数之外支持 keyword 关键字筛选
+// 参数校验与SDK一致，缺少必填参数时返回400
+func (h *HTTPHandler) ServeDeviceList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, "method not allowed", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	req := handler.GetDeviceListRequest{
+		Voucher:           query.Get("voucher"),
+		ServiceIdentifier: query.Get("service_identifier"),
+	}
+	page, pageErr := strconv.Atoi(query.Get("page"))
+	pageSize, sizeErr := strconv.Atoi(query.Get("page_size"))
+	if req.Voucher == "" || pageErr != nil || sizeErr != nil {
+		writeJSON(w, http.StatusBadRequest, "missing required query parameters", nil)
+		return
+	}
+	req.Page, req.PageSize = page, pageSize
+
+	rsp, err := h.deviceList(&req, query.Get("keyword"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", rsp.Data)
+}
+
+// deviceList 按接入点过滤规则和关键字筛选go2rtc中的流，按名称排序分页
+// 描述中包含源类型、主机(已隐藏用户名密码)、编码、生产者状态和观看人数，便于绑定时选择
+func (h *HTTPHandler) deviceList(req *handler.GetDeviceListRequest, keyword string) (*handler.DeviceListResponse, error) {
 	h.logger.WithFields(logrus.Fields{
-		"voucher":            req.Voucher,
 		"service_identifier": req.ServiceIdentifier,
 		"page":               req.Page,
 		"page_size":          req.PageSize,
+		"keyword":            keyword,
 	}).Info("收到获取设备列表请求")
 
 	// 解析req的Voucher到formjson.SVCRForm结构体
@@ -252,35 +457,47 @@ func (h *HTTPHandler) handleGetDeviceList(req *handler.GetDeviceListRequest) (*h
 		return nil, err
 	}
 
-	// 尝试从go2rtc获取streams列表
+	// 按接入点过滤规则筛选可绑定的流
+	filter, err := go2rtc.NewStreamFilter(go2rtc.FilterConfigFromVoucher(svcrForm))
+	if err != nil {
+		h.logger.WithError(err).Error("解析过滤规则失败")
+		return nil, err
+	}
+
 	devices := []handler.DeviceItem{} // 初始化为空切片，确保返回[]而非null
+	total := 0
 
 	// 获取go2rtc handler
-	var gh *go2rtc.Go2RTCProtocolHandler
-	if g, ok := h.protocolHandler.(*go2rtc.Go2RTCProtocolHandler); ok {
-		gh = g
-	} else if sph, ok := h.protocolHandler.(*protocol.SingleProtocolHandler); ok {
-		if g, ok := sph.GetHandler().(*go2rtc.Go2RTCProtocolHandler); ok {
-			gh = g
-		}
-	}
-
-	if gh != nil {
-		// 如果SVCR中配置了API URL，更新handler
-		if svcrForm.APIURL != "" {
-			gh.SetAPIURL(svcrForm.APIURL)
-		}
+	if base := h.go2rtcHandler(); base != nil {
+		// 按请求中凭证的API URL和认证创建本次请求使用的handler，不修改共用的handler
+		gh := base.WithVoucher(svcrForm)
 
-		// 获取streams列表
-		streams, err := gh.ListStreams()
+		streams, err := gh.ListStreamStates()
 		if err != nil {
 			h.logger.WithError(err).Warn("获取go2rtc streams失败")
 		} else {
+			allStreams := make(map[string]bool, len(streams))
 			for _, stream := range streams {
+				allStreams[stream.Name] = true
+			}
+			candidates := make([]go2rtc.StreamState, 0, len(streams))
+			for _, stream := range streams {
+				if h.nvrs.IsChannelStream(stream.Name) {
+					continue
+				}
+				if ok, _ := filter.Match(stream.StreamInfo, allStreams); !ok {
+					continue
+				}
+				candidates = append(candidates, stream)
+			}
+
+			var items []go2rtc.StreamListItem
+			items, total = go2rtc.PageStreams(candidates, keyword, req.Page, req.PageSize)
+			for _, item := range items {
 				devices = append(devices, handler.DeviceItem{
-					DeviceName:   stream.Name,
-					DeviceNumber: stream.Name,
-					Description:  "go2rtc stream",
+					DeviceName:   item.Name,
+					DeviceNumber: item.Name,
+					Description:  item.Description,
 				})
 			}
 		}
@@ -290,7 +507,7 @@ func (h *HTTPHandler) handleGetDeviceList(req *handler.GetDeviceListRequest) (*h
 		Code:    200,
 		Message: "获取成功",
 		Data: handler.DeviceListData{
-			Total: len(devices),
+			Total: total,
 			List:  devices,
 		},
 	}
@@ -0,0 +1,419 @@
+// internal/health/monitor.go
+
+// Package health 平台心跳、失败恢复与适配器健康状态汇总
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+	"tp-plugin/internal/platform"
+	"tp-plugin/internal/protocol/plugins/go2rtc"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 默认值
+const (
+	defaultFailureThreshold = 3
+	defaultRecoveryCooldown = 5 * time.Minute
+	heartbeatTimeout        = 10 * time.Second
+)
+
+// 健康状态
+const (
+	StatusOK       = "ok"       // 全部正常
+	StatusDegraded = "degraded" // MQTT断开、go2rtc不可达、发件箱积压或心跳偶发失败
+	StatusDown     = "down"     // 心跳连续失败达到阈值，平台无响应
+)
+
+// Config 心跳与恢复配置
+type Config struct {
+	ServiceIdentifier string
+	Interval          time.Duration // 心跳间隔
+	FailureThreshold  int           // 连续失败多少次后执行恢复，默认3
+	RecoveryCooldown  time.Duration // 两次恢复的最小间隔，默认5分钟
+	SelfDevice        SelfDeviceConfig
+}
+
+// SelfDeviceConfig 适配器自身设备
+type SelfDeviceConfig struct {
+	Enabled      bool
+	DeviceNumber string // 为空时使用 服务标识符-adapter-实例ID
+	DeviceName   string // 为空时与设备编号相同
+}
+
+// HeartbeatStatus 心跳状态
+type HeartbeatStatus struct {
+	Interval            string     `json:"interval"`
+	LastSentAt          *time.Time `json:"last_sent_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	LastError           string     `json:"last_error,omitempty"`
+	Recoveries          int64      `json:"recoveries"`
+	LastRecoveryAt      *time.Time `json:"last_recovery_at,omitempty"`
+}
+
+// Summary 适配器健康状态汇总
+type Summary struct {
+	Status       string                     `json:"status"`
+	CheckedAt    time.Time                  `json:"checked_at"`
+	Heartbeat    HeartbeatStatus            `json:"heartbeat"`
+	MQTT         platform.ConnectionStatus  `json:"mqtt"`
+	Outbox       platform.OutboxStats       `json:"outbox"`
+	AccessPoints []go2rtc.AccessPointHealth `json:"access_points"`
+	Runtime      RuntimeStats               `json:"runtime"`
+	SelfDeviceID string                     `json:"self_device_id,omitempty"`
+}
+
+// Monitor 定时发送平台心跳并跟踪连续失败次数
+// 平台连续无响应时依次重连MQTT、重新加载接入点并触发全量同步；
+// 每次心跳后将健康状态汇总作为遥测上报到适配器自身设备
+type Monitor struct {
+	platform    *platform.PlatformClient
+	syncManager *go2rtc.SyncManager
+	logger      *logrus.Logger
+	cfg         Config
+
+	mu             sync.Mutex
+	lastSentAt     time.Time
+	lastSuccessAt  time.Time
+	failures       int
+	lastErr        error
+	recoveries     int64
+	lastRecoveryAt time.Time
+	recovering     bool           // 恢复操作进行中，避免重叠执行
+	recoveryWG     sync.WaitGroup // Stop 时等待进行中的恢复结束
+	selfDeviceID   string
+	startedAt      time.Time
+	lastCounters   counters // 上次上报自身设备遥测时的累计计数
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMonitor 创建心跳与健康监控，syncManager 可为nil
+func NewMonitor(pc *platform.PlatformClient, syncManager *go2rtc.SyncManager, logger *logrus.Logger, cfg Config) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.RecoveryCooldown <= 0 {
+		cfg.RecoveryCooldown = defaultRecoveryCooldown
+	}
+	if cfg.SelfDevice.DeviceNumber == "" {
+		cfg.SelfDevice.DeviceNumber = platform.ClientID(cfg.ServiceIdentifier+"-adapter", pc.InstanceID())
+	}
+	if cfg.SelfDevice.DeviceName == "" {
+		cfg.SelfDevice.DeviceName = cfg.SelfDevice.DeviceNumber
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Monitor{
+		platform:    pc,
+		syncManager: syncManager,
+		logger:      logger,
+		cfg:         cfg,
+		startedAt:   time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+}
+
+// Start 立即发送一次心跳，之后按间隔发送；MQTT断线重连成功后立即补发一次
+func (m *Monitor) Start() {
+	reconnected := make(chan struct{}, 1)
+	m.platform.OnConnectionStateChange(func(state platform.ConnectionState) {
+		if state != platform.ConnStateConnected {
+			return
+		}
+		select {
+		case reconnected <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+
+		m.beat()
+		for {
+			select {
+			case <-ticker.C:
+			case <-reconnected:
+			case <-m.ctx.Done():
+				m.logger.Info("心跳上报已停止")
+				return
+			}
+			m.beat()
+		}
+	}()
+}
+
+// Stop 停止心跳，适配器自身设备置为离线
+func (m *Monitor) Stop() {
+	m.cancel()
+	<-m.done
+	m.recoveryWG.Wait()
+
+	m.mu.Lock()
+	selfDeviceID := m.selfDeviceID
+	m.mu.Unlock()
+	if selfDeviceID != "" {
+		if err := m.platform.SendDeviceStatus(selfDeviceID, platform.DeviceStatusOffline); err != nil {
+			m.logger.WithError(err).Warn("适配器设备离线状态上报失败")
+		}
+	}
+}
+
+// beat 发送一次心跳，按结果执行恢复并上报健康状态
+func (m *Monitor) beat() {
+	err := m.sendHeartbeat()
+
+	m.mu.Lock()
+	now := time.Now()
+	m.lastSentAt = now
+	prevFailures := m.failures
+	if err != nil {
+		m.failures++
+		m.lastErr = err
+	} else {
+		m.failures = 0
+		m.lastErr = nil
+		m.lastSuccessAt = now
+	}
+	failures := m.failures
+	needRecovery := failures >= m.cfg.FailureThreshold && !m.recovering &&
+		(m.lastRecoveryAt.IsZero() || now.Sub(m.lastRecoveryAt) >= m.cfg.RecoveryCooldown)
+	if needRecovery {
+		m.recoveries++
+		m.lastRecoveryAt = now
+		m.recovering = true
+		m.recoveryWG.Add(1)
+	}
+	m.mu.Unlock()
+
+	metrics.HeartbeatFailures.Set(int64(failures))
+	switch {
+	case err != nil:
+		m.logger.WithError(err).WithField("consecutive_failures", failures).Error("发送心跳失败")
+	case prevFailures > 0:
+		m.logger.Infof("平台心跳已恢复，此前连续失败%d次", prevFailures)
+	}
+
+	// 重新加载接入点可能耗时较长，在独立的goroutine中执行，不阻塞心跳
+	if needRecovery {
+		go m.recover(failures)
+	}
+	if m.cfg.SelfDevice.Enabled {
+		m.publishSelf()
+	}
+}
+
+// sendHeartbeat 发送心跳，日志中附带MQTT连接状态
+// 心跳走HTTP接口，MQTT断线时心跳仍可成功
+func (m *Monitor) sendHeartbeat() error {
+	conn := m.platform.ConnectionStatus()
+	entry := m.logger.WithFields(logrus.Fields{
+		"mqtt_state":      conn.State,
+		"mqtt_reconnects": conn.Reconnects,
+	})
+
+	ctx, cancel := context.WithTimeout(m.ctx, heartbeatTimeout)
+	defer cancel()
+	if err := m.platform.SendHeartbeat(ctx, m.cfg.ServiceIdentifier); err != nil {
+		return fmt.Errorf("%w (mqtt_state=%s)", err, conn.State)
+	}
+
+	if conn.State != platform.ConnStateConnected {
+		entry.Warn("心跳发送成功，但MQTT未连接")
+	} else {
+		entry.Debug("心跳发送成功")
+	}
+	return nil
+}
+
+// recover 平台连续无响应时的恢复操作
+func (m *Monitor) recover(failures int) {
+	defer func() {
+		m.mu.Lock()
+		m.recovering = false
+		m.mu.Unlock()
+		m.recoveryWG.Done()
+	}()
+
+	metrics.HealthRecoveries.Add(1)
+	logger := m.logger.WithField("consecutive_failures", failures)
+	logger.Warn("平台心跳连续失败，开始恢复")
+
+	m.platform.ReconnectMQTT()
+	logger.Info("恢复: 已断开MQTT并立即重连")
+
+	if m.syncManager == nil {
+		return
+	}
+	result, err := m.syncManager.ReloadForRecovery()
+	if err != nil {
+		// 接入点列表不可用时按现有同步服务全部重新同步
+		logger.WithError(err).Warn("恢复: 重新加载服务接入点失败")
+		jobs := m.syncManager.Resync()
+		logger.Infof("恢复: 已触发%d个接入点同步", len(jobs))
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"created": len(result.Created),
+		"rebuilt": len(result.Rebuilt),
+		"removed": len(result.Removed),
+	}).Info("恢复: 已重新加载服务接入点")
+
+	// 新建和重建的接入点已在启动时同步，只触发未变化的接入点
+	jobs := m.syncManager.ResyncAccessPoints(result.Unchanged)
+	logger.Infof("恢复: 已触发%d个未变化接入点同步", len(jobs))
+}
+
+// Summary 汇总当前健康状态，会实时检查各接入点的go2rtc
+func (m *Monitor) Summary() Summary {
+	summary := Summary{
+		CheckedAt:    time.Now(),
+		MQTT:         m.platform.ConnectionStatus(),
+		Outbox:       m.platform.OutboxStats(),
+		AccessPoints: []go2rtc.AccessPointHealth{},
+	}
+	if m.syncManager != nil {
+		summary.AccessPoints = m.syncManager.Health()
+	}
+	summary.Runtime = readRuntimeStats(m.startedAt)
+
+	m.mu.Lock()
+	summary.Heartbeat = HeartbeatStatus{
+		Interval:            m.cfg.Interval.String(),
+		LastSentAt:          timePtr(m.lastSentAt),
+		LastSuccessAt:       timePtr(m.lastSuccessAt),
+		ConsecutiveFailures: m.failures,
+		FailureThreshold:    m.cfg.FailureThreshold,
+		Recoveries:          m.recoveries,
+		LastRecoveryAt:      timePtr(m.lastRecoveryAt),
+	}
+	if m.lastErr != nil {
+		summary.Heartbeat.LastError = m.lastErr.Error()
+	}
+	summary.SelfDeviceID = m.selfDeviceID
+	m.mu.Unlock()
+
+	summary.Status = summary.status()
+	return summary
+}
+
+// status 按各项检查结果判断整体状态
+func (s *Summary) status() string {
+	if s.Heartbeat.ConsecutiveFailures >= s.Heartbeat.FailureThreshold {
+		return StatusDown
+	}
+	if s.Heartbeat.ConsecutiveFailures > 0 || s.MQTT.State != platform.ConnStateConnected || s.Outbox.Depth > 0 {
+		return StatusDegraded
+	}
+	for _, ap := range s.AccessPoints {
+		if !ap.Reachable {
+			return StatusDegraded
+		}
+	}
+	return StatusOK
+}
+
+// telemetry 上报到适配器自身设备的遥测
+func (s *Summary) telemetry() map[string]interface{} {
+	reachable, unreachable := 0, 0
+	var maxLag int64
+	for _, ap := range s.AccessPoints {
+		if ap.Reachable {
+			reachable++
+		} else {
+			unreachable++
+		}
+		if ap.SyncLagSec > maxLag {
+			maxLag = ap.SyncLagSec
+		}
+	}
+	return map[string]interface{}{
+		"health_status":      s.Status,
+		"mqtt_state":         string(s.MQTT.State),
+		"mqtt_reconnects":    s.MQTT.Reconnects,
+		"heartbeat_failures": s.Heartbeat.ConsecutiveFailures,
+		"recoveries":         s.Heartbeat.Recoveries,
+		"outbox_depth":       s.Outbox.Depth,
+		"go2rtc_reachable":   reachable,
+		"go2rtc_unreachable": unreachable,
+		"max_sync_lag_sec":   maxLag,
+	}
+}
+
+// publishSelf 注册适配器自身设备并上报健康状态和运行指标
+// MQTT断线期间的上报进入发件箱，连接恢复后补发
+func (m *Monitor) publishSelf() {
+	deviceID, err := m.selfDevice()
+	if err != nil {
+		m.logger.WithError(err).Warn("注册适配器设备失败")
+		return
+	}
+
+	summary := m.Summary()
+	if err := m.platform.SendDeviceStatus(deviceID, platform.DeviceStatusOnline); err != nil {
+		m.logger.WithError(err).Warn("适配器设备状态上报失败")
+	}
+	values := summary.telemetry()
+	for key, value := range m.operationalTelemetry(&summary) {
+		values[key] = value
+	}
+	if err := m.platform.SendTelemetry(deviceID, values); err != nil {
+		m.logger.WithError(err).Warn("适配器健康状态上报失败")
+	}
+}
+
+// selfDevice 获取适配器自身设备ID，首次调用时动态注册，设备已存在时查询
+func (m *Monitor) selfDevice() (string, error) {
+	m.mu.Lock()
+	deviceID := m.selfDeviceID
+	m.mu.Unlock()
+	if deviceID != "" {
+		return deviceID, nil
+	}
+
+	number := m.cfg.SelfDevice.DeviceNumber
+	data, err := m.platform.DynamicRegister(number, m.cfg.SelfDevice.DeviceName)
+	switch {
+	case err == nil && data != nil && data.DeviceID != "":
+		deviceID = data.DeviceID
+		m.logger.Infof("适配器设备注册成功: %s (%s)", number, deviceID)
+	case err == nil || errors.Is(err, platform.ErrAlreadyExists):
+		device, err := m.platform.GetDevice(number)
+		if err != nil {
+			return "", err
+		}
+		deviceID = device.ID
+	default:
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.selfDeviceID = deviceID
+	m.mu.Unlock()
+	return deviceID, nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,96 @@
+// internal/health/runtime.go
+package health
+
+import (
+	"runtime"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+)
+
+// RuntimeStats 适配器进程的运行状态
+type RuntimeStats struct {
+	Goroutines  int     `json:"goroutines"`
+	HeapAllocMB float64 `json:"heap_alloc_mb"`
+	SysMB       float64 `json:"sys_mb"`
+	NumGC       uint32  `json:"num_gc"`
+	UptimeSec   int64   `json:"uptime_sec"`
+}
+
+func readRuntimeStats(startedAt time.Time) RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return RuntimeStats{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAllocMB: toMB(mem.HeapAlloc),
+		SysMB:       toMB(mem.Sys),
+		NumGC:       mem.NumGC,
+		UptimeSec:   int64(time.Since(startedAt) / time.Second),
+	}
+}
+
+// counters 累计计数的快照，相邻两次上报的差值即为区间内的发生次数
+type counters struct {
+	publishFailures int64
+	go2rtcRequests  int64
+	go2rtcErrors    int64
+	go2rtcLatencyMs float64
+}
+
+func readCounters() counters {
+	return counters{
+		publishFailures: metrics.MQTTPublishFailures.Value(),
+		go2rtcRequests:  metrics.Go2RTCRequests.Value(),
+		go2rtcErrors:    metrics.Go2RTCErrors.Value(),
+		go2rtcLatencyMs: metrics.Go2RTCLatencyMs.Value(),
+	}
+}
+
+// operationalTelemetry 运行指标遥测
+// 发布失败数、go2rtc请求数、错误率和平均耗时按距上次上报的区间统计，
+// 累计值可通过 /api/v1/metrics 查看
+func (m *Monitor) operationalTelemetry(s *Summary) map[string]interface{} {
+	current := readCounters()
+	m.mu.Lock()
+	prev := m.lastCounters
+	m.lastCounters = current
+	m.mu.Unlock()
+
+	streams := 0
+	var maxSyncMs int64
+	for _, ap := range s.AccessPoints {
+		streams += ap.SyncedDevices
+		if ap.SyncDurationMs > maxSyncMs {
+			maxSyncMs = ap.SyncDurationMs
+		}
+	}
+
+	requests := current.go2rtcRequests - prev.go2rtcRequests
+	var errorRate, avgLatency float64
+	if requests > 0 {
+		errorRate = round2(float64(current.go2rtcErrors-prev.go2rtcErrors) / float64(requests))
+		avgLatency = round2((current.go2rtcLatencyMs - prev.go2rtcLatencyMs) / float64(requests))
+	}
+
+	return map[string]interface{}{
+		"goroutines":            s.Runtime.Goroutines,
+		"heap_alloc_mb":         s.Runtime.HeapAllocMB,
+		"sys_mb":                s.Runtime.SysMB,
+		"gc_count":              s.Runtime.NumGC,
+		"uptime_sec":            s.Runtime.UptimeSec,
+		"managed_streams":       streams,
+		"max_sync_duration_ms":  maxSyncMs,
+		"mqtt_publish_failures": current.publishFailures - prev.publishFailures,
+		"go2rtc_requests":       requests,
+		"go2rtc_error_rate":     errorRate,
+		"go2rtc_avg_latency_ms": avgLatency,
+	}
+}
+
+func toMB(bytes uint64) float64 {
+	return round2(float64(bytes) / (1 << 20))
+}
+
+func round2(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
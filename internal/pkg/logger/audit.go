@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// globalAuditLogger 审计日志记录器，未初始化时审计记录只写入主日志
+var globalAuditLogger *logrus.Logger
+var auditLoggerMu sync.RWMutex
+
+// InitAuditLogger 初始化审计日志，每条记录以JSON行写入独立文件
+// path 为空时不写入独立文件
+func InitAuditLogger(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建审计日志目录失败: %v", err)
+	}
+
+	auditLogger := logrus.New()
+	auditLogger.SetOutput(&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    50,
+		MaxBackups: 10,
+		MaxAge:     180,
+		Compress:   true,
+	})
+	auditLogger.SetFormatter(&logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02 15:04:05",
+	})
+	auditLogger.SetLevel(logrus.InfoLevel)
+
+	auditLoggerMu.Lock()
+	globalAuditLogger = auditLogger
+	auditLoggerMu.Unlock()
+
+	logrus.WithField("path", path).Info("审计日志已启用")
+	return nil
+}
+
+// LogAudit 记录审计事件
+// action: 动作，如 offline/decommission/restore
+func LogAudit(action string, fields map[string]interface{}) {
+	entryFields := logrus.Fields{"action": action}
+	for k, v := range fields {
+		entryFields[k] = v
+	}
+
+	logrus.WithFields(entryFields).Info("审计")
+
+	auditLoggerMu.RLock()
+	auditLogger := globalAuditLogger
+	auditLoggerMu.RUnlock()
+	if auditLogger != nil {
+		auditLogger.WithFields(entryFields).Info(action)
+	}
+}
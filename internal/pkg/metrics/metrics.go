@@ -0,0 +1,47 @@
+// internal/pkg/metrics/metrics.go
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// 适配器运行指标，通过 expvar 以JSON形式暴露
+var (
+	// MQTT发件箱
+	OutboxDepth     = expvar.NewInt("mqtt_outbox_depth")     // 待重发的消息数
+	OutboxDropped   = expvar.NewInt("mqtt_outbox_dropped")   // 超出容量被丢弃的消息数
+	OutboxCollapsed = expvar.NewInt("mqtt_outbox_collapsed") // 被同主题新消息替换的消息数
+	OutboxReplayed  = expvar.NewInt("mqtt_outbox_replayed")  // 重连后重发成功的消息数
+
+	// MQTT连接
+	MQTTState           = expvar.NewString("mqtt_state")         // 连接状态
+	MQTTConnected       = expvar.NewInt("mqtt_connected")        // 1为已连接
+	MQTTReconnects      = expvar.NewInt("mqtt_reconnects")       // 断线后重连成功的次数
+	MQTTPublishFailures = expvar.NewInt("mqtt_publish_failures") // 发布失败的消息数(含超时)，失败的消息转入发件箱
+
+	// 平台响应
+	AcksPending  = expvar.NewInt("platform_acks_pending")  // 等待平台响应的消息数
+	AckTimeouts  = expvar.NewInt("platform_ack_timeouts")  // 超时未收到响应的消息数
+	AcksRejected = expvar.NewInt("platform_acks_rejected") // 被平台拒绝的消息数
+
+	// 设备缓存
+	DeviceCacheEntries   = expvar.NewInt("device_cache_entries")   // 缓存的设备数
+	DeviceCacheHits      = expvar.NewInt("device_cache_hits")      // 命中次数，含不存在记录
+	DeviceCacheMisses    = expvar.NewInt("device_cache_misses")    // 未命中、需查询平台的次数
+	DeviceCacheEvictions = expvar.NewInt("device_cache_evictions") // 超出容量被淘汰的设备数
+
+	// 平台心跳
+	HeartbeatFailures = expvar.NewInt("heartbeat_consecutive_failures") // 连续失败的心跳数
+	HealthRecoveries  = expvar.NewInt("health_recoveries")              // 心跳连续失败后执行恢复的次数
+
+	// go2rtc API
+	Go2RTCRequests  = expvar.NewInt("go2rtc_requests")           // 请求数
+	Go2RTCErrors    = expvar.NewInt("go2rtc_errors")             // 连接失败或返回5xx的请求数
+	Go2RTCLatencyMs = expvar.NewFloat("go2rtc_latency_ms_total") // 请求耗时累计(毫秒)，除以请求数得平均耗时
+)
+
+// Handler 指标查询接口
+func Handler() http.Handler {
+	return expvar.Handler()
+}
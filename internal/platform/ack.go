@@ -0,0 +1,235 @@
+// internal/platform/ack.go
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 默认等待平台响应的时间
+const defaultAckTimeout = 10 * time.Second
+
+// 等待平台响应的错误
+var (
+	ErrAckTimeout = errors.New("等待平台响应超时")
+	ErrAckQueued  = errors.New("MQTT未连接，消息已存入发件箱") // 消息未发出，无法等待响应
+	ErrRejected   = errors.New("平台拒绝了消息")
+)
+
+// 需要平台响应的消息类型，对应响应主题 plugin/{服务标识符}/devices/{类型}/response/{设备ID}/{消息ID}
+const (
+	ackKindAttributes = "attributes"
+	ackKindEvent      = "event"
+)
+
+// AckResult 平台对上报消息的响应
+type AckResult struct {
+	Kind      string `json:"kind"`
+	DeviceID  string `json:"device_id"`
+	MessageID string `json:"message_id"`
+	Result    int    `json:"result"` // 0为成功
+	ErrCode   string `json:"errcode,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Ts        int64  `json:"ts,omitempty"`
+}
+
+// Accepted 平台是否接受了消息
+func (r *AckResult) Accepted() bool {
+	return r.Result == 0
+}
+
+// Err 平台拒绝时返回错误
+func (r *AckResult) Err() error {
+	if r.Accepted() {
+		return nil
+	}
+	msg := r.Message
+	if msg == "" {
+		msg = r.ErrCode
+	}
+	return fmt.Errorf("%w: %s/%s: result=%d %s", ErrRejected, r.Kind, r.MessageID, r.Result, msg)
+}
+
+// pendingAck 已发送、等待平台响应的消息
+type pendingAck struct {
+	kind     string
+	deviceID string
+	sentAt   time.Time
+	done     chan *AckResult // 收到响应时写入，超时时关闭
+}
+
+// ackTracker 按消息ID匹配平台响应
+// 超时未收到响应的消息会被清理并记录日志，等待方收到 ErrAckTimeout
+type ackTracker struct {
+	timeout time.Duration
+	logger  *logrus.Logger
+
+	mu      sync.Mutex
+	pending map[string]*pendingAck
+}
+
+func newAckTracker(timeout time.Duration, logger *logrus.Logger) *ackTracker {
+	if timeout <= 0 {
+		timeout = defaultAckTimeout
+	}
+	return &ackTracker{
+		timeout: timeout,
+		logger:  logger,
+		pending: make(map[string]*pendingAck),
+	}
+}
+
+// add 登记等待响应的消息
+func (t *ackTracker) add(kind, deviceID, messageID string) *pendingAck {
+	pa := &pendingAck{
+		kind:     kind,
+		deviceID: deviceID,
+		sentAt:   time.Now(),
+		done:     make(chan *AckResult, 1),
+	}
+	t.mu.Lock()
+	t.pending[messageID] = pa
+	metrics.AcksPending.Set(int64(len(t.pending)))
+	t.mu.Unlock()
+	return pa
+}
+
+// remove 取消等待(消息未能发出)
+func (t *ackTracker) remove(messageID string) {
+	t.mu.Lock()
+	delete(t.pending, messageID)
+	metrics.AcksPending.Set(int64(len(t.pending)))
+	t.mu.Unlock()
+}
+
+// resolve 收到平台响应，未登记的消息ID返回false
+func (t *ackTracker) resolve(result *AckResult) bool {
+	t.mu.Lock()
+	pa, ok := t.pending[result.MessageID]
+	if ok {
+		delete(t.pending, result.MessageID)
+		metrics.AcksPending.Set(int64(len(t.pending)))
+	}
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	entry := t.logger.WithFields(logrus.Fields{
+		"kind":       pa.kind,
+		"device_id":  pa.deviceID,
+		"message_id": result.MessageID,
+		"latency_ms": time.Since(pa.sentAt).Milliseconds(),
+	})
+	if result.Accepted() {
+		entry.Debug("平台已确认消息")
+	} else {
+		metrics.AcksRejected.Add(1)
+		entry.WithField("result", result.Result).Warnf("平台拒绝了消息: %s", result.Message)
+	}
+
+	pa.done <- result
+	return true
+}
+
+// expire 清理超时未响应的消息
+func (t *ackTracker) expire(now time.Time) {
+	t.mu.Lock()
+	var expired map[string]*pendingAck
+	for id, pa := range t.pending {
+		if now.Sub(pa.sentAt) < t.timeout {
+			continue
+		}
+		if expired == nil {
+			expired = make(map[string]*pendingAck)
+		}
+		expired[id] = pa
+		delete(t.pending, id)
+	}
+	metrics.AcksPending.Set(int64(len(t.pending)))
+	t.mu.Unlock()
+
+	for id, pa := range expired {
+		metrics.AckTimeouts.Add(1)
+		t.logger.WithFields(logrus.Fields{
+			"kind":       pa.kind,
+			"device_id":  pa.deviceID,
+			"message_id": id,
+		}).Warnf("%v 内未收到平台响应", t.timeout)
+		close(pa.done)
+	}
+}
+
+// wait 等待平台响应
+func (pa *pendingAck) wait(ctx context.Context) (*AckResult, error) {
+	select {
+	case result, ok := <-pa.done:
+		if !ok {
+			return nil, ErrAckTimeout
+		}
+		return result, result.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// messageIDGenerator 生成进程内严格递增的消息ID(毫秒时间戳)
+// 同一毫秒内的多条消息顺延到下一毫秒，重启后只要时钟不回拨也不会重复
+type messageIDGenerator struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (g *messageIDGenerator) next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := time.Now().UnixMilli()
+	if id <= g.last {
+		id = g.last + 1
+	}
+	g.last = id
+	return strconv.FormatInt(id, 10)
+}
+
+// ackResponseTopic 平台响应的订阅主题
+func ackResponseTopic(serviceIdentifier, kind string) string {
+	return fmt.Sprintf("plugin/%s/devices/%s/response/+/+", serviceIdentifier, kind)
+}
+
+// handleAckResponse 处理平台响应
+// topic格式: plugin/{service_identifier}/devices/{kind}/response/{device_id}/{message_id}
+func (p *PlatformClient) handleAckResponse(topic string, payload []byte) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 7 {
+		p.logger.Errorf("响应主题格式错误: %s", topic)
+		return
+	}
+
+	result := &AckResult{
+		Kind:      parts[3],
+		DeviceID:  parts[5],
+		MessageID: parts[6],
+	}
+	if err := json.Unmarshal(payload, result); err != nil {
+		p.logger.WithError(err).Errorf("解析平台响应失败: %s", string(payload))
+		return
+	}
+	// 响应体中的字段不覆盖主题中的标识
+	result.Kind, result.DeviceID, result.MessageID = parts[3], parts[5], parts[6]
+
+	if !p.acks.resolve(result) {
+		// 超时已清理或发件箱重发的消息
+		p.logger.Debugf("收到未登记消息的平台响应: %s", topic)
+	}
+}
@@ -0,0 +1,59 @@
+// internal/platform/api_client.go
+package platform
+
+import (
+	"errors"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/client"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrAPIOnly 仅API客户端不建立MQTT连接，无法上报设备数据
+var ErrAPIOnly = errors.New("仅API客户端不支持MQTT上报")
+
+// APIClient 只通过HTTP访问平台API的客户端
+// 不建立MQTT连接、不加载发件箱，供同步预览等只读场景使用，不会与运行中的插件抢占MQTT会话或重发其消息
+type APIClient struct {
+	sdkClient *client.Client
+	logger    *logrus.Logger
+	devices   *deviceCache
+	Config    Config
+}
+
+var _ Client = (*APIClient)(nil)
+
+// NewAPIClient 创建仅API客户端，只使用配置中的平台地址、服务标识符和模板密钥
+func NewAPIClient(config Config, logger *logrus.Logger) (*APIClient, error) {
+	sdkClient, err := client.NewClient(client.ClientConfig{
+		BaseURL: config.BaseURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &APIClient{
+		sdkClient: sdkClient,
+		logger:    logger,
+		devices:   newDeviceCache(config.DeviceCache),
+		Config:    config,
+	}, nil
+}
+
+// SendDeviceStatus 仅API客户端不支持，返回 ErrAPIOnly
+func (p *APIClient) SendDeviceStatus(deviceID string, status int) error {
+	return ErrAPIOnly
+}
+
+// SendTelemetry 仅API客户端不支持，返回 ErrAPIOnly
+func (p *APIClient) SendTelemetry(deviceID string, values map[string]interface{}) error {
+	return ErrAPIOnly
+}
+
+// SendAttributes 仅API客户端不支持，返回 ErrAPIOnly
+func (p *APIClient) SendAttributes(deviceID string, values map[string]interface{}) error {
+	return ErrAPIOnly
+}
+
+// SendEvent 仅API客户端不支持，返回 ErrAPIOnly
+func (p *APIClient) SendEvent(deviceID, method string, params map[string]interface{}) error {
+	return ErrAPIOnly
+}
@@ -0,0 +1,124 @@
+// internal/platform/attribute_set.go
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AttributeSetResponse 属性设置响应
+// result 为0表示成功，失败时 errcode 为指令错误码之一
+type AttributeSetResponse struct {
+	DeviceID string                 `json:"device_id"`
+	Result   int                    `json:"result"`
+	ErrCode  string                 `json:"errcode,omitempty"`
+	Message  string                 `json:"message"`
+	Ts       int64                  `json:"ts"`
+	Values   map[string]interface{} `json:"values,omitempty"`
+}
+
+// SendAttributeSetResponse 回复平台属性设置
+// topic: devices/attributes/set/response/{message_id}，与平台下发的消息ID一致
+func (p *PlatformClient) SendAttributeSetResponse(deviceID, messageID string, resp AttributeSetResponse) error {
+	resp.DeviceID = deviceID
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("序列化属性设置响应失败: %v", err)
+	}
+
+	if _, err := p.publish("devices/attributes/set/response/"+messageID, payload); err != nil {
+		return fmt.Errorf("发送属性设置响应失败: %v", err)
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"device_id":  deviceID,
+		"message_id": messageID,
+		"result":     resp.Result,
+	}).Debug("属性设置响应已发送")
+	return nil
+}
+
+// startAttributeSetSubscription 启动MQTT属性设置订阅
+func (p *PlatformClient) startAttributeSetSubscription() error {
+	topic := fmt.Sprintf("plugin/%s/devices/attributes/set/+/+", p.Config.ServiceIdentifier)
+
+	p.logger.Infof("开始订阅属性设置主题: %s", topic)
+
+	if err := p.conn.Subscribe(topic, 1, p.handleAttributeSetMessage); err != nil {
+		return fmt.Errorf("订阅属性设置主题失败: %v", err)
+	}
+
+	p.logger.Info("属性设置主题订阅成功")
+	return nil
+}
+
+// handleAttributeSetMessage 处理属性设置消息
+// 回调中只解析主题和消息体，处理和回复交给下行处理队列
+func (p *PlatformClient) handleAttributeSetMessage(topic string, payload []byte) {
+	p.logger.Debugf("接收到属性设置消息: topic=%s, payload=%s", topic, string(payload))
+
+	// topic格式: plugin/{service_identifier}/devices/attributes/set/{device_id}/{message_id}
+	parts := strings.Split(topic, "/")
+	if len(parts) != 7 {
+		p.logger.Errorf("属性设置主题格式错误: %s", topic)
+		return
+	}
+
+	deviceID := parts[5]
+	messageID := parts[6]
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(payload, &values); err != nil {
+		p.logger.WithError(err).Errorf("解析属性设置消息失败: %s", string(payload))
+		p.dispatch(deviceID, func() {
+			p.replyAttributeSet(deviceID, messageID, nil,
+				&CommandError{Code: CommandErrInvalidParams, Message: "属性设置消息格式错误"})
+		})
+		return
+	}
+
+	p.dispatch(deviceID, func() {
+		p.processAttributeSet(deviceID, messageID, values)
+	})
+}
+
+// processAttributeSet 执行属性设置并回复平台
+func (p *PlatformClient) processAttributeSet(deviceID, messageID string, values map[string]interface{}) {
+	if p.attrSetProcessor == nil {
+		p.logger.Error("属性设置处理器未设置，无法处理属性设置")
+		p.replyAttributeSet(deviceID, messageID, nil,
+			&CommandError{Code: CommandErrUnsupported, Message: "属性设置处理器未设置"})
+		return
+	}
+
+	applied, err := p.attrSetProcessor.ProcessAttributeSet(deviceID, messageID, values)
+	if err != nil {
+		p.logger.WithError(err).Errorf("处理属性设置失败: deviceID=%s, messageID=%s", deviceID, messageID)
+	} else {
+		p.logger.Infof("属性设置处理成功: deviceID=%s, messageID=%s", deviceID, messageID)
+	}
+	p.replyAttributeSet(deviceID, messageID, applied, err)
+}
+
+// replyAttributeSet 按处理结果回复属性设置，发送失败只记录日志
+func (p *PlatformClient) replyAttributeSet(deviceID, messageID string, applied map[string]interface{}, err error) {
+	resp := AttributeSetResponse{
+		Ts:     time.Now().Unix(),
+		Values: applied,
+	}
+	if err != nil {
+		resp.Result = 1
+		resp.ErrCode = commandErrCode(err)
+		resp.Message = err.Error()
+	} else {
+		resp.Message = "success"
+	}
+
+	if sendErr := p.SendAttributeSetResponse(deviceID, messageID, resp); sendErr != nil {
+		p.logger.WithError(sendErr).Errorf("发送属性设置响应失败: deviceID=%s, messageID=%s", deviceID, messageID)
+	}
+}
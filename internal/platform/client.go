@@ -0,0 +1,32 @@
+// internal/platform/client.go
+package platform
+
+import "github.com/ThingsPanel/tp-protocol-sdk-go/types"
+
+// DeviceRegistry 设备查询与动态注册
+type DeviceRegistry interface {
+	GetDevice(deviceNumber string) (*types.Device, error)
+	GetDeviceByID(deviceID string) (*types.Device, error)
+	ClearDeviceCache(deviceNumber string)
+	ClearDeviceCacheByID(deviceID string)
+	DynamicRegister(deviceNumber string, deviceName string) (*types.DeviceDynamicAuthData, error)
+	SubDeviceDynamicRegister(deviceNumber string, subDeviceAddr string, parentDeviceNumber string) (*types.DeviceDynamicAuthData, error)
+}
+
+// DeviceReporter 设备状态、遥测、属性及事件上报
+type DeviceReporter interface {
+	SendDeviceStatus(deviceID string, status int) error
+	SendTelemetry(deviceID string, values map[string]interface{}) error
+	SendAttributes(deviceID string, values map[string]interface{}) error
+	SendEvent(deviceID, method string, params map[string]interface{}) error
+}
+
+// Client 设备同步和HTTP处理器使用的平台操作
+// *PlatformClient 为连接真实平台的实现，测试时使用 platformtest.Platform
+type Client interface {
+	DeviceRegistry
+	DeviceReporter
+	GetServiceAccessPoints() ([]types.ServiceAccessRsp, error)
+}
+
+var _ Client = (*PlatformClient)(nil)
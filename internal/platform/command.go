@@ -0,0 +1,85 @@
+// internal/platform/command.go
+package platform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 指令响应错误码
+const (
+	CommandErrInvalidParams = "invalid_params" // 参数缺失或格式错误
+	CommandErrUnsupported   = "unsupported"    // 不支持的指令
+	CommandErrNotFound      = "not_found"      // 设备或流不存在
+	CommandErrUpstream      = "upstream_error" // go2rtc等上游服务返回错误
+	CommandErrInternal      = "internal_error" // 其他错误
+)
+
+// CommandError 指令处理错误，Code 作为指令响应的 errcode
+type CommandError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// NewCommandError 创建指令处理错误
+func NewCommandError(code string, err error, format string, args ...interface{}) *CommandError {
+	return &CommandError{Code: code, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// commandErrCode 响应使用的错误码，非 *CommandError 按内部错误处理
+func commandErrCode(err error) string {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code
+	}
+	return CommandErrInternal
+}
+
+// CommandResponse 指令响应
+// result 为0表示成功，失败时 errcode 为上面的错误码之一
+type CommandResponse struct {
+	DeviceID string      `json:"device_id"`
+	Result   int         `json:"result"`
+	ErrCode  string      `json:"errcode,omitempty"`
+	Message  string      `json:"message"`
+	Ts       int64       `json:"ts"`
+	Method   string      `json:"method"`
+	Params   interface{} `json:"params,omitempty"`
+}
+
+// SendCommandResponse 回复平台指令
+// topic: devices/command/response/{message_id}，与平台下发指令的消息ID一致
+func (p *PlatformClient) SendCommandResponse(deviceID, messageID string, resp CommandResponse) error {
+	resp.DeviceID = deviceID
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("序列化指令响应失败: %v", err)
+	}
+
+	if _, err := p.publish("devices/command/response/"+messageID, payload); err != nil {
+		return fmt.Errorf("发送指令响应失败: %v", err)
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"device_id":  deviceID,
+		"message_id": messageID,
+		"method":     resp.Method,
+		"result":     resp.Result,
+	}).Debug("指令响应已发送")
+	return nil
+}
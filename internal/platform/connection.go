@@ -0,0 +1,464 @@
+// internal/platform/connection.go
+package platform
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+// 连接管理默认值
+const (
+	defaultConnectTimeout    = 30 * time.Second
+	defaultReconnectMinDelay = time.Second
+	defaultReconnectMaxDelay = 2 * time.Minute
+	mqttKeepAlive            = 30 * time.Second
+	mqttDisconnectQuiesce    = 250 // 毫秒
+	mqttInboxSize            = 256 // 待分发的订阅消息上限
+)
+
+// ConnectionState MQTT连接状态
+type ConnectionState string
+
+const (
+	ConnStateConnecting   ConnectionState = "connecting"   // 首次连接中
+	ConnStateConnected    ConnectionState = "connected"    // 已连接
+	ConnStateReconnecting ConnectionState = "reconnecting" // 连接断开，等待重连
+	ConnStateClosed       ConnectionState = "closed"       // 已主动关闭
+)
+
+// MessageHandler MQTT消息处理函数
+type MessageHandler func(topic string, payload []byte)
+
+// ConnectionConfig MQTT连接配置
+type ConnectionConfig struct {
+	Broker         string
+	Username       string
+	Password       string
+	ClientID       string
+	ConnectTimeout time.Duration
+	MinDelay       time.Duration // 重连最小间隔
+	MaxDelay       time.Duration // 重连最大间隔
+}
+
+// ConnectionStatus MQTT连接状态快照
+type ConnectionStatus struct {
+	State          ConnectionState `json:"state"`
+	Broker         string          `json:"broker"`
+	ClientID       string          `json:"client_id"`
+	ConnectedAt    *time.Time      `json:"connected_at,omitempty"`
+	DisconnectedAt *time.Time      `json:"disconnected_at,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	Reconnects     int64           `json:"reconnects"`
+	Subscriptions  int             `json:"subscriptions"`
+}
+
+type subscription struct {
+	qos     byte
+	handler MessageHandler
+}
+
+// inboundMessage 待分发给订阅处理函数的消息
+type inboundMessage struct {
+	handler MessageHandler
+	topic   string
+	payload []byte
+}
+
+// ConnectionManager MQTT连接管理
+// 跟踪连接状态，断线后按指数退避重连，重连成功后恢复全部订阅
+// SDK的MQTT客户端使用 CleanSession 且不保留订阅，自动重连后订阅会丢失，因此这里直接管理paho客户端
+type ConnectionManager struct {
+	cfg    ConnectionConfig
+	logger *logrus.Logger
+	client mqtt.Client
+
+	mu             sync.RWMutex
+	state          ConnectionState
+	connectedAt    time.Time
+	disconnectedAt time.Time
+	lastErr        error
+	reconnects     int64
+	everConnected  bool
+	subs           map[string]subscription
+	listeners      []func(ConnectionState)
+
+	inbox    chan inboundMessage // 订阅消息由 dispatch 按到达顺序交给处理函数
+	lostCh   chan struct{}
+	kickCh   chan struct{} // 跳过重连等待，立即重连
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewConnectionManager 创建MQTT连接管理器
+func NewConnectionManager(cfg ConnectionConfig, logger *logrus.Logger) *ConnectionManager {
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaultConnectTimeout
+	}
+	if cfg.MinDelay <= 0 {
+		cfg.MinDelay = defaultReconnectMinDelay
+	}
+	if cfg.MaxDelay < cfg.MinDelay {
+		cfg.MaxDelay = defaultReconnectMaxDelay
+	}
+
+	m := &ConnectionManager{
+		cfg:    cfg,
+		logger: logger,
+		state:  ConnStateConnecting,
+		subs:   make(map[string]subscription),
+		inbox:  make(chan inboundMessage, mqttInboxSize),
+		lostCh: make(chan struct{}, 1),
+		kickCh: make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(false). // 由 run 负责重连，以便恢复订阅并记录状态
+		SetCleanSession(true).
+		SetKeepAlive(mqttKeepAlive).
+		SetConnectTimeout(cfg.ConnectTimeout)
+	opts.SetConnectionLostHandler(m.onConnectionLost)
+	m.client = mqtt.NewClient(opts)
+
+	metrics.MQTTState.Set(string(ConnStateConnecting))
+	go m.dispatch()
+	return m
+}
+
+// dispatch 在paho的收包协程之外调用订阅处理函数
+// paho默认在收包协程中依次执行回调，处理函数阻塞时PUBACK和心跳响应都无法处理
+func (m *ConnectionManager) dispatch() {
+	for {
+		select {
+		case msg := <-m.inbox:
+			msg.handler(msg.topic, msg.payload)
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// Start 首次连接并启动后台重连
+// 首次连接失败时返回错误，但后台仍会持续重连，期间的消息进入发件箱
+func (m *ConnectionManager) Start() error {
+	err := m.connect()
+	go m.run(err != nil)
+	return err
+}
+
+// run 连接断开后按指数退避重连
+func (m *ConnectionManager) run(reconnect bool) {
+	attempt := 0
+	for {
+		if !reconnect {
+			select {
+			case <-m.lostCh:
+			case <-m.stopCh:
+				return
+			}
+		}
+		reconnect = true
+
+		attempt++
+		delay := m.backoff(attempt)
+		m.logger.Infof("MQTT将在 %v 后重连(第%d次)", delay.Round(time.Millisecond), attempt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-m.kickCh:
+			timer.Stop()
+		case <-m.stopCh:
+			timer.Stop()
+			return
+		}
+
+		if err := m.connect(); err != nil {
+			continue
+		}
+		attempt = 0
+		reconnect = false
+	}
+}
+
+// connect 建立连接并恢复订阅
+func (m *ConnectionManager) connect() error {
+	m.logger.Infof("开始连接MQTT服务器: broker=%s, clientID=%s", m.cfg.Broker, m.cfg.ClientID)
+
+	token := m.client.Connect()
+	if !token.WaitTimeout(m.cfg.ConnectTimeout) {
+		err := fmt.Errorf("MQTT连接超时")
+		m.recordError(err)
+		return err
+	}
+	if err := token.Error(); err != nil {
+		err = fmt.Errorf("MQTT连接失败: %w", err)
+		m.recordError(err)
+		return err
+	}
+
+	m.mu.Lock()
+	reconnected := m.everConnected
+	m.everConnected = true
+	m.connectedAt = time.Now()
+	m.lastErr = nil
+	if reconnected {
+		m.reconnects++
+	}
+	m.mu.Unlock()
+
+	if reconnected {
+		metrics.MQTTReconnects.Add(1)
+	}
+	// 先标记为已连接，恢复订阅期间新登记的订阅会直接订阅而不会遗漏
+	m.setState(ConnStateConnected, nil)
+	m.resubscribe()
+	return nil
+}
+
+// onConnectionLost paho连接丢失回调
+func (m *ConnectionManager) onConnectionLost(_ mqtt.Client, err error) {
+	m.mu.Lock()
+	m.disconnectedAt = time.Now()
+	m.lastErr = err
+	m.mu.Unlock()
+
+	m.setState(ConnStateReconnecting, err)
+	select {
+	case m.lostCh <- struct{}{}:
+	default:
+	}
+}
+
+// Reconnect 断开当前连接并立即重连
+// 用于连接看似正常但平台已无响应的情况，重连成功后同样恢复全部订阅
+func (m *ConnectionManager) Reconnect() {
+	select {
+	case <-m.stopCh:
+		return
+	default:
+	}
+
+	// 已断开时后台正在等待重连，只需跳过等待
+	if m.State() == ConnStateConnected {
+		if m.client.IsConnectionOpen() {
+			m.client.Disconnect(mqttDisconnectQuiesce)
+		}
+		err := fmt.Errorf("主动重连")
+		m.mu.Lock()
+		m.disconnectedAt = time.Now()
+		m.lastErr = err
+		m.mu.Unlock()
+
+		m.setState(ConnStateReconnecting, err)
+		select {
+		case m.lostCh <- struct{}{}:
+		default:
+		}
+	}
+	select {
+	case m.kickCh <- struct{}{}:
+	default:
+	}
+}
+
+// resubscribe 恢复全部已登记的订阅
+func (m *ConnectionManager) resubscribe() {
+	m.mu.RLock()
+	subs := make(map[string]subscription, len(m.subs))
+	for topic, sub := range m.subs {
+		subs[topic] = sub
+	}
+	m.mu.RUnlock()
+
+	if len(subs) == 0 {
+		return
+	}
+
+	restored := 0
+	for topic, sub := range subs {
+		if err := m.subscribe(topic, sub); err != nil {
+			m.logger.WithError(err).Errorf("恢复订阅失败: %s", topic)
+			continue
+		}
+		restored++
+	}
+	m.logger.Infof("已恢复 %d/%d 个MQTT订阅", restored, len(subs))
+}
+
+// Subscribe 订阅主题并登记，重连后自动恢复
+// 未连接时只登记，连接建立后再订阅
+func (m *ConnectionManager) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	sub := subscription{qos: qos, handler: handler}
+
+	m.mu.Lock()
+	m.subs[topic] = sub
+	m.mu.Unlock()
+
+	if !m.IsConnected() {
+		m.logger.Infof("MQTT未连接，订阅将在连接建立后生效: %s", topic)
+		return nil
+	}
+	return m.subscribe(topic, sub)
+}
+
+func (m *ConnectionManager) subscribe(topic string, sub subscription) error {
+	handler := sub.handler
+	token := m.client.Subscribe(topic, sub.qos, func(_ mqtt.Client, msg mqtt.Message) {
+		select {
+		case m.inbox <- inboundMessage{handler: handler, topic: msg.Topic(), payload: msg.Payload()}:
+		default:
+			m.logger.Errorf("订阅消息分发队列已满，丢弃消息: %s", msg.Topic())
+		}
+	})
+	if !token.WaitTimeout(m.cfg.ConnectTimeout) {
+		return fmt.Errorf("主题订阅超时: %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("主题订阅失败: %w", err)
+	}
+	return nil
+}
+
+// Publish 发布消息，未连接时返回错误
+func (m *ConnectionManager) Publish(topic string, qos byte, payload []byte) error {
+	if !m.IsConnected() {
+		return fmt.Errorf("MQTT客户端未连接")
+	}
+
+	token := m.client.Publish(topic, qos, false, payload)
+	if !token.WaitTimeout(m.cfg.ConnectTimeout) {
+		metrics.MQTTPublishFailures.Add(1)
+		return fmt.Errorf("消息发布超时: %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		metrics.MQTTPublishFailures.Add(1)
+		return fmt.Errorf("消息发布失败: %w", err)
+	}
+	return nil
+}
+
+// IsConnected 是否已连接
+func (m *ConnectionManager) IsConnected() bool {
+	return m.State() == ConnStateConnected && m.client.IsConnectionOpen()
+}
+
+// State 当前连接状态
+func (m *ConnectionManager) State() ConnectionState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Status 连接状态快照
+func (m *ConnectionManager) Status() ConnectionStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := ConnectionStatus{
+		State:         m.state,
+		Broker:        m.cfg.Broker,
+		ClientID:      m.cfg.ClientID,
+		Reconnects:    m.reconnects,
+		Subscriptions: len(m.subs),
+	}
+	if !m.connectedAt.IsZero() {
+		t := m.connectedAt
+		status.ConnectedAt = &t
+	}
+	if !m.disconnectedAt.IsZero() {
+		t := m.disconnectedAt
+		status.DisconnectedAt = &t
+	}
+	if m.lastErr != nil {
+		status.LastError = m.lastErr.Error()
+	}
+	return status
+}
+
+// OnStateChange 注册连接状态变化回调
+func (m *ConnectionManager) OnStateChange(fn func(ConnectionState)) {
+	m.mu.Lock()
+	m.listeners = append(m.listeners, fn)
+	m.mu.Unlock()
+}
+
+// Close 断开连接并停止重连
+func (m *ConnectionManager) Close() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+		if m.client.IsConnectionOpen() {
+			m.client.Disconnect(mqttDisconnectQuiesce)
+		}
+		m.setState(ConnStateClosed, nil)
+	})
+}
+
+// setState 更新连接状态，记录日志与指标并通知回调
+func (m *ConnectionManager) setState(state ConnectionState, err error) {
+	m.mu.Lock()
+	prev := m.state
+	if prev == ConnStateClosed || prev == state {
+		m.mu.Unlock()
+		return
+	}
+	m.state = state
+	listeners := make([]func(ConnectionState), len(m.listeners))
+	copy(listeners, m.listeners)
+	m.mu.Unlock()
+
+	metrics.MQTTState.Set(string(state))
+	if state == ConnStateConnected {
+		metrics.MQTTConnected.Set(1)
+	} else {
+		metrics.MQTTConnected.Set(0)
+	}
+
+	entry := m.logger.WithFields(logrus.Fields{
+		"from":      prev,
+		"to":        state,
+		"client_id": m.cfg.ClientID,
+	})
+	switch state {
+	case ConnStateReconnecting:
+		entry.WithError(err).Warn("MQTT连接断开")
+	default:
+		entry.Info("MQTT连接状态变化")
+	}
+
+	for _, fn := range listeners {
+		fn(state)
+	}
+}
+
+// recordError 记录连接失败
+func (m *ConnectionManager) recordError(err error) {
+	m.mu.Lock()
+	m.lastErr = err
+	m.mu.Unlock()
+	m.logger.WithError(err).Warn("MQTT连接失败")
+}
+
+// backoff 第attempt次重连前的等待时间，带随机抖动避免多个实例同时重连
+func (m *ConnectionManager) backoff(attempt int) time.Duration {
+	delay := m.cfg.MinDelay
+	for i := 1; i < attempt && delay < m.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > m.cfg.MaxDelay {
+		delay = m.cfg.MaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
@@ -0,0 +1,218 @@
+// internal/platform/device_cache.go
+package platform
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// 设备缓存默认值
+const (
+	defaultDeviceCacheTTL         = 10 * time.Minute
+	defaultDeviceCacheNegativeTTL = 30 * time.Second
+	defaultDeviceCacheMaxEntries  = 10000
+)
+
+// DeviceCacheConfig 设备信息缓存配置
+type DeviceCacheConfig struct {
+	TTL         time.Duration // 设备信息缓存时间，默认10分钟
+	NegativeTTL time.Duration // 设备不存在的记录缓存时间，默认30秒
+	MaxEntries  int           // 最多缓存的设备数，超出时淘汰最久未使用的设备，默认10000
+}
+
+// DeviceCacheStats 设备缓存统计
+type DeviceCacheStats struct {
+	Entries   int   `json:"entries"`
+	Negative  int   `json:"negative"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// 不存在记录的键前缀，区分按设备编号与按设备ID的查询
+const (
+	missByNumber = "number:"
+	missByID     = "id:"
+)
+
+type deviceCacheEntry struct {
+	device  *types.Device
+	expires time.Time
+}
+
+// deviceCache 设备信息缓存，按设备编号和设备ID索引同一条记录
+// 记录超过TTL后失效，超出容量时按LRU淘汰；查询不到的设备短时间内不重复查询平台
+type deviceCache struct {
+	cfg DeviceCacheConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	lru      *list.List               // 元素为 *deviceCacheEntry，队首为最近使用
+	byNumber map[string]*list.Element // key为deviceNumber
+	byID     map[string]*list.Element // key为deviceID
+	misses   map[string]time.Time     // 不存在记录的过期时间
+
+	hits, lookups, evictions int64
+}
+
+func newDeviceCache(cfg DeviceCacheConfig) *deviceCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultDeviceCacheTTL
+	}
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = defaultDeviceCacheNegativeTTL
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultDeviceCacheMaxEntries
+	}
+	return &deviceCache{
+		cfg:      cfg,
+		now:      time.Now,
+		lru:      list.New(),
+		byNumber: make(map[string]*list.Element),
+		byID:     make(map[string]*list.Element),
+		misses:   make(map[string]time.Time),
+	}
+}
+
+// getByNumber 按设备编号查询，missing 为 true 表示设备近期查询不到
+func (c *deviceCache) getByNumber(deviceNumber string) (device *types.Device, missing bool) {
+	return c.get(c.byNumber, missByNumber+deviceNumber, deviceNumber)
+}
+
+// getByID 按设备ID查询
+func (c *deviceCache) getByID(deviceID string) (device *types.Device, missing bool) {
+	return c.get(c.byID, missByID+deviceID, deviceID)
+}
+
+func (c *deviceCache) get(index map[string]*list.Element, missKey, key string) (*types.Device, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if elem, ok := index[key]; ok {
+		entry := elem.Value.(*deviceCacheEntry)
+		if now.Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.hit()
+			return entry.device, false
+		}
+		c.removeLocked(elem)
+	}
+	if expires, ok := c.misses[missKey]; ok {
+		if now.Before(expires) {
+			c.hit()
+			return nil, true
+		}
+		delete(c.misses, missKey)
+	}
+	c.lookups++
+	metrics.DeviceCacheMisses.Add(1)
+	return nil, false
+}
+
+func (c *deviceCache) hit() {
+	c.hits++
+	metrics.DeviceCacheHits.Add(1)
+}
+
+// put 缓存设备信息，同时清除该设备的不存在记录
+func (c *deviceCache) put(device *types.Device) {
+	if device == nil || device.ID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.byID[device.ID]; ok {
+		c.removeLocked(elem)
+	}
+	if elem, ok := c.byNumber[device.DeviceNumber]; ok {
+		c.removeLocked(elem)
+	}
+	delete(c.misses, missByNumber+device.DeviceNumber)
+	delete(c.misses, missByID+device.ID)
+
+	elem := c.lru.PushFront(&deviceCacheEntry{device: device, expires: c.now().Add(c.cfg.TTL)})
+	c.byID[device.ID] = elem
+	if device.DeviceNumber != "" {
+		c.byNumber[device.DeviceNumber] = elem
+	}
+
+	for c.lru.Len() > c.cfg.MaxEntries {
+		c.removeLocked(c.lru.Back())
+		c.evictions++
+		metrics.DeviceCacheEvictions.Add(1)
+	}
+	metrics.DeviceCacheEntries.Set(int64(c.lru.Len()))
+}
+
+// putMissing 记录设备不存在
+func (c *deviceCache) putMissing(missKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.misses) >= c.cfg.MaxEntries {
+		for key, expires := range c.misses {
+			if !now.Before(expires) {
+				delete(c.misses, key)
+			}
+		}
+		// 仍然超出容量时不再记录，查询直接走平台
+		if len(c.misses) >= c.cfg.MaxEntries {
+			return
+		}
+	}
+	c.misses[missKey] = now.Add(c.cfg.NegativeTTL)
+}
+
+// removeByNumber 清除设备编号对应的缓存及不存在记录
+func (c *deviceCache) removeByNumber(deviceNumber string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.byNumber[deviceNumber]; ok {
+		c.removeLocked(elem)
+	}
+	delete(c.misses, missByNumber+deviceNumber)
+}
+
+// removeByID 清除设备ID对应的缓存及不存在记录
+func (c *deviceCache) removeByID(deviceID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.byID[deviceID]; ok {
+		c.removeLocked(elem)
+	}
+	delete(c.misses, missByID+deviceID)
+}
+
+// removeLocked 从两个索引中移除记录，调用方需持有锁
+func (c *deviceCache) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*deviceCacheEntry)
+	if c.byID[entry.device.ID] == elem {
+		delete(c.byID, entry.device.ID)
+	}
+	if c.byNumber[entry.device.DeviceNumber] == elem {
+		delete(c.byNumber, entry.device.DeviceNumber)
+	}
+	metrics.DeviceCacheEntries.Set(int64(c.lru.Len()))
+}
+
+// stats 缓存统计
+func (c *deviceCache) stats() DeviceCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return DeviceCacheStats{
+		Entries:   c.lru.Len(),
+		Negative:  len(c.misses),
+		Hits:      c.hits,
+		Misses:    c.lookups,
+		Evictions: c.evictions,
+	}
+}
@@ -0,0 +1,64 @@
+// internal/platform/downlink.go
+package platform
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// 下行消息(指令、控制、属性设置)的处理协程数和每个协程的队列长度
+const (
+	downlinkWorkers   = 8
+	downlinkQueueSize = 64
+)
+
+// downlinkQueue 在MQTT消息回调之外处理下行消息
+// 处理过程包含平台和go2rtc的HTTP请求以及QoS1回复，在回调中执行会阻塞MQTT收包，
+// 导致PUBACK和心跳响应无法处理；同一设备的消息由同一协程按到达顺序处理，不同设备并行
+type downlinkQueue struct {
+	queues []chan func()
+	stopCh chan struct{}
+	once   sync.Once
+}
+
+func newDownlinkQueue(workers, size int) *downlinkQueue {
+	q := &downlinkQueue{
+		queues: make([]chan func(), workers),
+		stopCh: make(chan struct{}),
+	}
+	for i := range q.queues {
+		q.queues[i] = make(chan func(), size)
+		go q.run(q.queues[i])
+	}
+	return q
+}
+
+func (q *downlinkQueue) run(jobs chan func()) {
+	for {
+		select {
+		case job := <-jobs:
+			job()
+		case <-q.stopCh:
+			return
+		}
+	}
+}
+
+// submit 按设备ID分配处理协程，不阻塞调用方；队列已满或已停止时返回false
+func (q *downlinkQueue) submit(deviceID string, job func()) bool {
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	select {
+	case q.queues[h.Sum32()%uint32(len(q.queues))] <- job:
+		return true
+	case <-q.stopCh:
+		return false
+	default:
+		return false
+	}
+}
+
+// stop 停止处理，队列中未处理的消息丢弃
+func (q *downlinkQueue) stop() {
+	q.once.Do(func() { close(q.stopCh) })
+}
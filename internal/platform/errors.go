@@ -0,0 +1,172 @@
+// internal/platform/errors.go
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 平台错误类型，调用方使用 errors.Is 判断
+var (
+	ErrAlreadyExists         = errors.New("设备已存在")
+	ErrNotFound              = errors.New("设备不存在")
+	ErrUnauthorized          = errors.New("平台认证失败")
+	ErrInvalidTemplateSecret = errors.New("模板密钥无效")
+	ErrRateLimited           = errors.New("平台请求过于频繁")
+	ErrTransient             = errors.New("平台暂时不可用")
+)
+
+// PlatformError 平台接口错误
+// Code 为平台响应中的业务码，HTTPStatus 为HTTP状态码(请求未返回200时)
+type PlatformError struct {
+	Op         string // 操作，如 "直连设备动态注册"
+	Code       int
+	HTTPStatus int
+	Message    string
+	Kind       error // 错误类型，为上面的 Err* 之一，未识别时为nil
+	Err        error // 底层错误
+}
+
+func (e *PlatformError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	b.WriteString("失败")
+	if e.Code != 0 {
+		fmt.Fprintf(&b, ": code=%d", e.Code)
+	}
+	if e.HTTPStatus != 0 {
+		fmt.Fprintf(&b, ": status=%d", e.HTTPStatus)
+	}
+	if e.Message != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	} else if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap 同时支持按错误类型和底层错误判断
+func (e *PlatformError) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// IsRetryable 判断错误是否值得重试
+// 认证失败、模板密钥无效、设备已存在等确定性错误重试也不会成功
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pe *PlatformError
+	if !errors.As(err, &pe) {
+		return true
+	}
+	return pe.Kind == nil || errors.Is(pe.Kind, ErrTransient) || errors.Is(pe.Kind, ErrRateLimited)
+}
+
+// ErrorCode 获取平台错误的业务码，非平台错误返回0
+func ErrorCode(err error) int {
+	var pe *PlatformError
+	if errors.As(err, &pe) {
+		return pe.Code
+	}
+	return 0
+}
+
+// newResponseError 根据平台响应的业务码和消息生成错误
+func newResponseError(op string, code int, message string) error {
+	return &PlatformError{
+		Op:      op,
+		Code:    code,
+		Message: message,
+		Kind:    classifyCode(code, message),
+	}
+}
+
+// SDK在HTTP状态码非200时只返回格式化的错误信息，从中解析状态码
+var sdkStatusPattern = regexp.MustCompile(`状态码: (\d+)`)
+
+// wrapRequestError 包装SDK请求错误(网络错误或HTTP状态码非200)
+func wrapRequestError(op string, err error) error {
+	pe := &PlatformError{Op: op, Err: err}
+
+	if m := sdkStatusPattern.FindStringSubmatch(err.Error()); m != nil {
+		pe.HTTPStatus, _ = strconv.Atoi(m[1])
+		pe.Kind = classifyCode(pe.HTTPStatus, "")
+		return pe
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		pe.Kind = ErrTransient
+	case strings.Contains(err.Error(), "执行请求失败"), strings.Contains(err.Error(), "读取响应体失败"):
+		// SDK以 %w 包装了http.Client错误，连接被拒绝等同样属于暂时性错误
+		pe.Kind = ErrTransient
+	}
+	return pe
+}
+
+// classifyCode 按业务码(与HTTP状态码一致)识别错误类型
+// 平台部分接口对业务错误统一返回通用错误码，此时按消息内容兜底识别
+func classifyCode(code int, message string) error {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrAlreadyExists
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		http.StatusRequestTimeout:
+		return ErrTransient
+	}
+
+	msg := strings.ToLower(message)
+	switch {
+	case msg == "":
+		if code >= 500 {
+			return ErrTransient
+		}
+		return nil
+	case containsAny(msg, "模板密钥", "template_secret", "template secret", "密钥错误", "密钥无效"):
+		return ErrInvalidTemplateSecret
+	// "does not exist" 同样包含 "exist"，不存在需先于已存在判断
+	case containsAny(msg, "不存在", "not found", "not exist"):
+		return ErrNotFound
+	case containsAny(msg, "已存在", "already exist", "duplicate"):
+		return ErrAlreadyExists
+	case containsAny(msg, "未授权", "无权限", "unauthorized", "forbidden", "invalid token", "token expired", "token无效", "token已过期"):
+		return ErrUnauthorized
+	case containsAny(msg, "频繁", "rate limit", "too many"):
+		return ErrRateLimited
+	case code >= 500:
+		return ErrTransient
+	}
+	return nil
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		message string
+		want    error
+	}{
+		{"HTTP 401", 401, "", ErrUnauthorized},
+		{"HTTP 403", 403, "", ErrUnauthorized},
+		{"HTTP 404", 404, "", ErrNotFound},
+		{"HTTP 409", 409, "", ErrAlreadyExists},
+		{"HTTP 429", 429, "", ErrRateLimited},
+		{"HTTP 503", 503, "", ErrTransient},
+		{"通用500无消息", 500, "", ErrTransient},
+		{"通用400无消息", 400, "", nil},
+		{"设备已存在", 400, "设备已存在", ErrAlreadyExists},
+		{"already exists", 400, "Device already exists", ErrAlreadyExists},
+		{"duplicate", 400, "duplicate key value violates unique constraint", ErrAlreadyExists},
+		{"设备不存在", 400, "设备不存在", ErrNotFound},
+		{"does not exist", 400, "device does not exist", ErrNotFound},
+		{"record not found", 400, "record not found", ErrNotFound},
+		{"模板密钥无效", 400, "模板密钥无效", ErrInvalidTemplateSecret},
+		{"template secret not found", 400, "template secret not found", ErrInvalidTemplateSecret},
+		{"未授权", 400, "未授权访问", ErrUnauthorized},
+		{"invalid token", 400, "invalid token", ErrUnauthorized},
+		{"消息提到token但非认证错误", 400, "token field is required", nil},
+		{"请求频繁", 400, "请求过于频繁", ErrRateLimited},
+		{"未识别的500", 500, "internal error", ErrTransient},
+		{"未识别的400", 400, "参数错误", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyCode(tt.code, tt.message); got != tt.want {
+				t.Errorf("classifyCode(%d, %q) = %v, 期望 %v", tt.code, tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapRequestError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantKind   error
+		retryable  bool
+	}{
+		{"HTTP 401", errors.New("请求失败，状态码: 401, 响应: unauthorized"), 401, ErrUnauthorized, false},
+		{"HTTP 404", errors.New("请求失败，状态码: 404, 响应: "), 404, ErrNotFound, false},
+		{"HTTP 502", errors.New("请求失败，状态码: 502, 响应: bad gateway"), 502, ErrTransient, true},
+		{"HTTP 500", errors.New("请求失败，状态码: 500, 响应: "), 500, ErrTransient, true},
+		{"HTTP 400", errors.New("请求失败，状态码: 400, 响应: "), 400, nil, true},
+		{"超时", fmt.Errorf("执行请求失败: %w", context.DeadlineExceeded), 0, ErrTransient, true},
+		{"连接被拒绝", fmt.Errorf("执行请求失败: %w", errors.New("dial tcp: connection refused")), 0, ErrTransient, true},
+		{"读取响应失败", fmt.Errorf("读取响应体失败: %w", errors.New("unexpected EOF")), 0, ErrTransient, true},
+		{"未识别", errors.New("序列化请求失败"), 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapRequestError("获取设备信息", tt.err)
+			var pe *PlatformError
+			if !errors.As(err, &pe) {
+				t.Fatalf("错误类型 = %T, 期望 *PlatformError", err)
+			}
+			if pe.HTTPStatus != tt.wantStatus {
+				t.Errorf("HTTPStatus = %d, 期望 %d", pe.HTTPStatus, tt.wantStatus)
+			}
+			if pe.Kind != tt.wantKind {
+				t.Errorf("Kind = %v, 期望 %v", pe.Kind, tt.wantKind)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Error("应保留底层错误")
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("IsRetryable = %v, 期望 %v", got, tt.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// internal/platform/instance.go
+package platform
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadInstanceID 获取适配器实例ID
+// 优先使用配置值；否则读取 file，文件不存在时生成 主机名-随机后缀 并保存
+// 实例ID持久化后不随容器重建时的主机名变化，同一主机上使用不同数据目录的多个实例也互不相同
+// file 为空时生成的ID只在本次运行内有效
+func LoadInstanceID(configured, file string) (string, error) {
+	if id := sanitizeID(strings.TrimSpace(configured)); id != "" {
+		return id, nil
+	}
+	if file == "" {
+		return newInstanceID(), nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err == nil {
+		if id := sanitizeID(strings.TrimSpace(string(data))); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("读取实例ID失败: %v", err)
+	}
+
+	id := newInstanceID()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", fmt.Errorf("创建实例ID目录失败: %v", err)
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("保存实例ID失败: %v", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return "", fmt.Errorf("保存实例ID失败: %v", err)
+	}
+	return id, nil
+}
+
+// ClientID 生成MQTT客户端ID：服务标识符-实例ID
+func ClientID(serviceIdentifier, instanceID string) string {
+	return fmt.Sprintf("%s-%s", serviceIdentifier, instanceID)
+}
+
+// newInstanceID 生成 主机名-6位随机十六进制 形式的实例ID
+func newInstanceID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	host, err := os.Hostname()
+	if host = sanitizeID(host); err != nil || host == "" {
+		return hex.EncodeToString(suffix)
+	}
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// sanitizeID 将字母、数字、'-'、'_' 以外的字符替换为 '-'
+func sanitizeID(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, s)
+}
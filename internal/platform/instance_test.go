@@ -0,0 +1,40 @@
+package platform
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadInstanceID(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data", "instance_id")
+
+	first, err := LoadInstanceID("", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadInstanceID("", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" || again != first {
+		t.Errorf("重启后实例ID = %q, 期望保持 %q", again, first)
+	}
+
+	// 另一数据目录的实例生成不同的ID
+	other, err := LoadInstanceID("", filepath.Join(t.TempDir(), "instance_id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Errorf("不同实例的ID相同: %q", other)
+	}
+
+	// 配置值优先，非法字符替换为 '-'
+	configured, err := LoadInstanceID("edge 01", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configured != "edge-01" {
+		t.Errorf("配置的实例ID = %q, 期望 edge-01", configured)
+	}
+}
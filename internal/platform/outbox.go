@@ -0,0 +1,366 @@
+// internal/platform/outbox.go
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 发件箱默认值
+const (
+	defaultOutboxMaxMessages = 10000
+	outboxReplayInterval     = time.Second
+	outboxCompactMinRecords  = 1000 // 日志记录数超过 max(该值, 2倍消息数) 时压缩
+)
+
+// 默认只保留最新一条的主题前缀：设备状态只有最后一次有意义
+var defaultCollapseTopics = []string{"devices/status/"}
+
+// OutboxConfig MQTT发件箱配置
+type OutboxConfig struct {
+	File           string   // 持久化文件，为空时只保存在内存
+	MaxMessages    int      // 最大消息数，超出时丢弃最早的消息
+	CollapseTopics []string // 主题前缀，同一主题只保留最新一条消息
+}
+
+// outboxMessage 待发送的消息
+type outboxMessage struct {
+	Seq       uint64    `json:"seq"`
+	Topic     string    `json:"topic"`
+	QoS       byte      `json:"qos"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// outboxRecord 发件箱日志中的一行
+// Msg 为追加的消息，Ack 为已发送、被合并或被丢弃的消息序号
+type outboxRecord struct {
+	Msg *outboxMessage `json:"msg,omitempty"`
+	Ack []uint64       `json:"ack,omitempty"`
+}
+
+// OutboxStats 发件箱统计
+type OutboxStats struct {
+	Depth     int        `json:"depth"`
+	Dropped   int64      `json:"dropped"`
+	Collapsed int64      `json:"collapsed"`
+	Replayed  int64      `json:"replayed"`
+	Oldest    *time.Time `json:"oldest,omitempty"`
+}
+
+// Outbox MQTT断线期间的消息暂存队列
+// 消息按发布顺序以追加日志的方式保存到磁盘，每条消息只追加一行；
+// 启动加载和队列清空时压缩日志，连接恢复后按顺序重发
+type Outbox struct {
+	cfg    OutboxConfig
+	logger *logrus.Logger
+
+	mu        sync.Mutex
+	journal   *os.File // 追加写入的日志文件
+	records   int      // 日志中的记录数
+	messages  []outboxMessage
+	seq       uint64
+	dropped   int64
+	collapsed int64
+	replayed  int64
+}
+
+// NewOutbox 创建发件箱并加载上次未发送的消息
+func NewOutbox(cfg OutboxConfig, logger *logrus.Logger) (*Outbox, error) {
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = defaultOutboxMaxMessages
+	}
+	if cfg.CollapseTopics == nil {
+		cfg.CollapseTopics = defaultCollapseTopics
+	}
+
+	o := &Outbox{cfg: cfg, logger: logger}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	// 加载后立即压缩，只保留未发送的消息
+	if err := o.compactLocked(); err != nil {
+		return nil, err
+	}
+	if len(o.messages) > 0 {
+		logger.Infof("MQTT发件箱中有 %d 条上次未发送的消息", len(o.messages))
+	}
+	metrics.OutboxDepth.Set(int64(len(o.messages)))
+	return o, nil
+}
+
+// Len 待发送的消息数
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.messages)
+}
+
+// Enqueue 追加消息
+// 可合并主题的旧消息会被移除，队列已满时丢弃最早的消息
+func (o *Outbox) Enqueue(topic string, qos byte, payload []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var removed []uint64
+	if o.collapsible(topic) {
+		kept := o.messages[:0]
+		for _, msg := range o.messages {
+			if msg.Topic == topic {
+				removed = append(removed, msg.Seq)
+				o.collapsed++
+				metrics.OutboxCollapsed.Add(1)
+				continue
+			}
+			kept = append(kept, msg)
+		}
+		o.messages = kept
+	}
+
+	o.seq++
+	msg := outboxMessage{
+		Seq:       o.seq,
+		Topic:     topic,
+		QoS:       qos,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	o.messages = append(o.messages, msg)
+
+	if overflow := len(o.messages) - o.cfg.MaxMessages; overflow > 0 {
+		for _, dropped := range o.messages[:overflow] {
+			removed = append(removed, dropped.Seq)
+		}
+		o.messages = append([]outboxMessage(nil), o.messages[overflow:]...)
+		o.dropped += int64(overflow)
+		metrics.OutboxDropped.Add(int64(overflow))
+		o.logger.Warnf("MQTT发件箱已满，丢弃最早的 %d 条消息", overflow)
+	}
+
+	metrics.OutboxDepth.Set(int64(len(o.messages)))
+	records := []outboxRecord{{Msg: &msg}}
+	if len(removed) > 0 {
+		records = append(records, outboxRecord{Ack: removed})
+	}
+	o.appendLocked(records...)
+}
+
+// Replay 按顺序重发消息，遇到发送失败时停止，返回成功发送的数量
+func (o *Outbox) Replay(publish func(topic string, qos byte, payload []byte) error) (int, error) {
+	sent := 0
+	var acked []uint64
+	defer func() {
+		if sent > 0 {
+			o.mu.Lock()
+			o.replayed += int64(sent)
+			metrics.OutboxReplayed.Add(int64(sent))
+			metrics.OutboxDepth.Set(int64(len(o.messages)))
+			if len(acked) > 0 {
+				o.appendLocked(outboxRecord{Ack: acked})
+			}
+			o.mu.Unlock()
+		}
+	}()
+
+	for {
+		o.mu.Lock()
+		if len(o.messages) == 0 {
+			o.mu.Unlock()
+			return sent, nil
+		}
+		msg := o.messages[0]
+		o.mu.Unlock()
+
+		if err := publish(msg.Topic, msg.QoS, msg.Payload); err != nil {
+			return sent, err
+		}
+
+		o.mu.Lock()
+		// 发送期间该消息可能已被合并移除，按序号确认
+		if len(o.messages) > 0 && o.messages[0].Seq == msg.Seq {
+			o.messages = o.messages[1:]
+			acked = append(acked, msg.Seq)
+		}
+		o.mu.Unlock()
+		sent++
+	}
+}
+
+// Close 关闭日志文件
+func (o *Outbox) Close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.journal != nil {
+		o.journal.Close()
+		o.journal = nil
+	}
+}
+
+// Stats 发件箱统计
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := OutboxStats{
+		Depth:     len(o.messages),
+		Dropped:   o.dropped,
+		Collapsed: o.collapsed,
+		Replayed:  o.replayed,
+	}
+	if len(o.messages) > 0 {
+		oldest := o.messages[0].CreatedAt
+		stats.Oldest = &oldest
+	}
+	return stats
+}
+
+func (o *Outbox) collapsible(topic string) bool {
+	for _, prefix := range o.cfg.CollapseTopics {
+		if prefix != "" && strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// load 加载持久化的消息
+// 逐行回放日志；兼容旧版本整体写入的JSON数组，末尾写入不完整的记录直接忽略
+func (o *Outbox) load() error {
+	if o.cfg.File == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(o.cfg.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取MQTT发件箱失败: %v", err)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &o.messages); err != nil {
+			return fmt.Errorf("解析MQTT发件箱失败: %v", err)
+		}
+	} else {
+		index := make(map[uint64]int)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			var record outboxRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				o.logger.WithError(err).Warnf("MQTT发件箱第%d行记录不完整，已忽略", line)
+				continue
+			}
+			if record.Msg != nil {
+				index[record.Msg.Seq] = len(o.messages)
+				o.messages = append(o.messages, *record.Msg)
+			}
+			for _, seq := range record.Ack {
+				if i, ok := index[seq]; ok {
+					o.messages[i].Seq = 0
+					delete(index, seq)
+				}
+			}
+		}
+		kept := o.messages[:0]
+		for _, msg := range o.messages {
+			if msg.Seq != 0 {
+				kept = append(kept, msg)
+			}
+		}
+		o.messages = kept
+	}
+
+	for _, msg := range o.messages {
+		if msg.Seq > o.seq {
+			o.seq = msg.Seq
+		}
+	}
+	return nil
+}
+
+// appendLocked 向日志追加记录，调用方需持有锁
+// 队列已清空或日志中的过期记录过多时压缩
+func (o *Outbox) appendLocked(records ...outboxRecord) {
+	if o.cfg.File == "" {
+		return
+	}
+
+	threshold := 2 * len(o.messages)
+	if threshold < outboxCompactMinRecords {
+		threshold = outboxCompactMinRecords
+	}
+	if o.journal == nil || len(o.messages) == 0 || o.records+len(records) > threshold {
+		if err := o.compactLocked(); err != nil {
+			o.logger.WithError(err).Error("压缩MQTT发件箱失败")
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			o.logger.WithError(err).Error("序列化MQTT发件箱失败")
+			return
+		}
+	}
+	if _, err := o.journal.Write(buf.Bytes()); err != nil {
+		o.logger.WithError(err).Error("写入MQTT发件箱失败")
+		return
+	}
+	o.records += len(records)
+}
+
+// compactLocked 只保留未发送的消息重写日志，并重新打开以追加写入，调用方需持有锁
+func (o *Outbox) compactLocked() error {
+	if o.cfg.File == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range o.messages {
+		if err := enc.Encode(outboxRecord{Msg: &o.messages[i]}); err != nil {
+			return fmt.Errorf("序列化MQTT发件箱失败: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(o.cfg.File), 0755); err != nil {
+		return fmt.Errorf("创建MQTT发件箱目录失败: %v", err)
+	}
+
+	tmp := o.cfg.File + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入MQTT发件箱失败: %v", err)
+	}
+	if o.journal != nil {
+		o.journal.Close()
+		o.journal = nil
+	}
+	if err := os.Rename(tmp, o.cfg.File); err != nil {
+		return fmt.Errorf("写入MQTT发件箱失败: %v", err)
+	}
+
+	journal, err := os.OpenFile(o.cfg.File, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开MQTT发件箱失败: %v", err)
+	}
+	o.journal = journal
+	o.records = len(o.messages)
+	return nil
+}
@@ -0,0 +1,125 @@
+package platform
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func newTestOutbox(t *testing.T, file string) *Outbox {
+	t.Helper()
+	o, err := NewOutbox(OutboxConfig{File: file}, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(o.Close)
+	return o
+}
+
+func topics(o *Outbox) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	result := make([]string, 0, len(o.messages))
+	for _, msg := range o.messages {
+		result = append(result, msg.Topic)
+	}
+	return result
+}
+
+func TestOutboxJournalSurvivesRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "outbox.jsonl")
+	o := newTestOutbox(t, file)
+
+	o.Enqueue("devices/telemetry", 1, []byte("t1"))
+	o.Enqueue("devices/status/cam1", 1, []byte("1"))
+	o.Enqueue("devices/telemetry", 1, []byte("t2"))
+	o.Enqueue("devices/status/cam1", 1, []byte("0")) // 合并前一条状态
+
+	// 只发送第一条
+	publishErr := errors.New("断开")
+	sent, err := o.Replay(func(topic string, qos byte, payload []byte) error {
+		if string(payload) != "t1" {
+			return publishErr
+		}
+		return nil
+	})
+	if sent != 1 || !errors.Is(err, publishErr) {
+		t.Fatalf("Replay = %d, %v", sent, err)
+	}
+
+	// 每次入队只追加记录，不重写已有内容
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 6 {
+		t.Errorf("日志记录数 = %d, 期望 6 (4条消息、1条合并、1条确认)", lines)
+	}
+	o.Close()
+
+	reopened := newTestOutbox(t, file)
+	want := []string{"devices/telemetry", "devices/status/cam1"}
+	if got := topics(reopened); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("重启后的消息 = %v, 期望 %v", got, want)
+	}
+	if stats := reopened.Stats(); stats.Depth != 2 {
+		t.Errorf("Depth = %d, 期望 2", stats.Depth)
+	}
+
+	// 加载后已压缩，只保留未发送的消息
+	data, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("压缩后记录数 = %d, 期望 2", lines)
+	}
+}
+
+func TestOutboxIgnoresTornRecord(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "outbox.jsonl")
+	o := newTestOutbox(t, file)
+	o.Enqueue("devices/telemetry", 1, []byte("t1"))
+	o.Close()
+
+	// 模拟写入过程中进程退出
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"msg":{"seq":2,"topic":"devices/tel`)
+	f.Close()
+
+	reopened := newTestOutbox(t, file)
+	if got := topics(reopened); len(got) != 1 {
+		t.Errorf("消息 = %v, 期望只有完整写入的1条", got)
+	}
+}
+
+func TestOutboxLoadsLegacyArray(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "outbox.json")
+	legacy := `[{"seq":3,"topic":"devices/telemetry","qos":1,"payload":"dDE="},{"seq":4,"topic":"devices/status/cam1","qos":1,"payload":"MQ=="}]`
+	if err := os.WriteFile(file, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := newTestOutbox(t, file)
+	if got := topics(o); len(got) != 2 {
+		t.Fatalf("消息 = %v, 期望 2 条", got)
+	}
+	o.Enqueue("devices/telemetry", 1, []byte("t2"))
+	if last := o.messages[len(o.messages)-1].Seq; last != 5 {
+		t.Errorf("新消息序号 = %d, 期望接续旧文件的 5", last)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -22,8 +23,9 @@ const (
 )
 
 // CommandProcessorInterface 指令处理器接口
+// 返回的数据作为指令响应的 params 回复平台，返回 *CommandError 时使用其中的错误码
 type CommandProcessorInterface interface {
-	ProcessCommand(deviceID, messageID string, message CommandMessage) error
+	ProcessCommand(deviceID, messageID string, message CommandMessage) (interface{}, error)
 }
 
 // ControlProcessorInterface 控制处理器接口
@@ -31,6 +33,12 @@ type ControlProcessorInterface interface {
 	ProcessControl(deviceID string, controlData map[string]interface{}) error
 }
 
+// AttributeSetProcessorInterface 属性设置处理器接口
+// 返回实际生效的属性值，返回 *CommandError 时使用其中的错误码回复平台
+type AttributeSetProcessorInterface interface {
+	ProcessAttributeSet(deviceID, messageID string, values map[string]interface{}) (map[string]interface{}, error)
+}
+
 // CommandMessage 指令消息结构
 type CommandMessage struct {
 	Method string      `json:"method"`
@@ -38,15 +46,21 @@ type CommandMessage struct {
 }
 
 // PlatformClient 平台客户端
+// 平台API部分由 APIClient 提供，这里补充MQTT连接、发件箱和指令处理
 type PlatformClient struct {
-	sdkClient        *client.Client
-	logger           *logrus.Logger
-	deviceCache      map[string]*types.Device // key为deviceNumber
-	deviceIDCache    map[string]*types.Device // key为deviceID
-	cacheMutex       sync.RWMutex
-	Config           Config
+	*APIClient
 	commandProcessor CommandProcessorInterface
 	controlProcessor ControlProcessorInterface
+	attrSetProcessor AttributeSetProcessorInterface
+
+	conn      *ConnectionManager // MQTT连接管理
+	acks      *ackTracker        // 等待平台响应的消息
+	msgIDs    messageIDGenerator
+	outbox    *Outbox        // MQTT断线期间的消息暂存
+	downlink  *downlinkQueue // 指令、控制、属性设置的处理队列
+	publishMu sync.Mutex     // 保证直接发送与重发的消息顺序
+	stopCh    chan struct{}
+	closeOnce sync.Once
 }
 
 // Config 平台配置
@@ -55,52 +69,182 @@ type Config struct {
 	MQTTBroker            string
 	MQTTUsername          string
 	MQTTPassword          string
+	MQTTClientID          string // 为空时使用 服务标识符-实例ID
+	InstanceID            string // 适配器实例ID，见 LoadInstanceID；为空时生成本次运行内有效的ID
 	ServiceIdentifier     string
 	TemplateSecret        string
 	SubTemplateSecret     string
 	GatewayTemplateSecret string
+	Outbox                OutboxConfig
+	AckTimeout            time.Duration // 等待平台响应的时间，默认10秒
+	DeviceCache           DeviceCacheConfig
 }
 
 // NewPlatformClient 创建平台客户端
 func NewPlatformClient(config Config, logger *logrus.Logger) (*PlatformClient, error) {
-	sdkConfig := client.ClientConfig{
-		BaseURL:      config.BaseURL,
-		MQTTBroker:   config.MQTTBroker,
-		MQTTUsername: config.MQTTUsername,
-		MQTTPassword: config.MQTTPassword,
-		MQTTClientID: fmt.Sprintf("%s-%d", config.ServiceIdentifier, time.Now().Unix()),
+	if config.InstanceID == "" {
+		config.InstanceID = newInstanceID()
+		logger.Warnf("未指定实例ID，使用临时实例ID: %s", config.InstanceID)
 	}
 
-	// 打印sdkConfig
-	logrus.Infof("sdkConfig: %+v", sdkConfig)
-
-	sdkClient, err := client.NewClient(sdkConfig)
+	// SDK客户端只用于平台API，MQTT连接由 ConnectionManager 管理
+	api, err := NewAPIClient(config, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := sdkClient.Connect(); err != nil {
+	outbox, err := NewOutbox(config.Outbox, logger)
+	if err != nil {
 		return nil, err
 	}
 
-	return &PlatformClient{
-		Config:        config,
-		sdkClient:     sdkClient,
-		logger:        logger,
-		deviceCache:   make(map[string]*types.Device), // key为deviceNumber
-		deviceIDCache: make(map[string]*types.Device), // key为deviceID
-	}, nil
+	clientID := config.MQTTClientID
+	if clientID == "" {
+		clientID = ClientID(config.ServiceIdentifier, config.InstanceID)
+	}
+	conn := NewConnectionManager(ConnectionConfig{
+		Broker:   config.MQTTBroker,
+		Username: config.MQTTUsername,
+		Password: config.MQTTPassword,
+		ClientID: clientID,
+	}, logger)
+
+	p := &PlatformClient{
+		APIClient: api,
+		conn:      conn,
+		acks:      newAckTracker(config.AckTimeout, logger),
+		outbox:    outbox,
+		downlink:  newDownlinkQueue(downlinkWorkers, downlinkQueueSize),
+		stopCh:    make(chan struct{}),
+	}
+
+	// 连接恢复后立即重发发件箱中的消息，不等下一次定时检查
+	conn.OnStateChange(func(state ConnectionState) {
+		if state == ConnStateConnected {
+			go p.replayOutbox()
+		}
+	})
+	// 平台对属性、事件上报的响应，需在连接前登记以便首次连接时订阅
+	for _, kind := range []string{ackKindAttributes, ackKindEvent} {
+		if err := conn.Subscribe(ackResponseTopic(config.ServiceIdentifier, kind), 1, p.handleAckResponse); err != nil {
+			logger.WithError(err).Errorf("订阅响应主题失败: %s", kind)
+		}
+	}
+
+	// 首次连接失败不影响启动，后台持续重连，期间的消息进入发件箱
+	if err := conn.Start(); err != nil {
+		logger.WithError(err).Warn("MQTT首次连接失败，将在后台重连")
+	}
+
+	go p.replayLoop()
+	return p, nil
+}
+
+// publish 发布消息，MQTT未连接或发送失败时存入发件箱，连接恢复后按顺序重发
+// 发件箱中还有消息时新消息同样排队，保证发送顺序；sent 为false表示消息已排队
+func (p *PlatformClient) publish(topic string, payload []byte) (sent bool, err error) {
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	if p.outbox.Len() == 0 && p.conn.IsConnected() {
+		err := p.conn.Publish(topic, 1, payload)
+		if err == nil {
+			return true, nil
+		}
+		p.logger.WithError(err).Warnf("消息发送失败，存入发件箱: %s", topic)
+	} else {
+		p.logger.Debugf("MQTT未连接或有待重发消息，存入发件箱: %s", topic)
+	}
+
+	p.outbox.Enqueue(topic, 1, payload)
+	return false, nil
+}
+
+// publishTracked 以唯一消息ID发布需要平台响应的消息，主题为 prefix/{消息ID}
+// 消息进入发件箱时不登记响应，返回 ErrAckQueued
+func (p *PlatformClient) publishTracked(kind, deviceID, prefix string, payload []byte) (string, *pendingAck, error) {
+	messageID := p.msgIDs.next()
+	pending := p.acks.add(kind, deviceID, messageID)
+
+	sent, err := p.publish(prefix+messageID, payload)
+	if err != nil {
+		p.acks.remove(messageID)
+		return messageID, nil, err
+	}
+	if !sent {
+		p.acks.remove(messageID)
+		return messageID, nil, ErrAckQueued
+	}
+	return messageID, pending, nil
+}
+
+// replayLoop 连接恢复后重发发件箱中的消息
+func (p *PlatformClient) replayLoop() {
+	ticker := time.NewTicker(outboxReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.replayOutbox()
+			p.acks.expire(now)
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// replayOutbox 按顺序重发发件箱中的消息
+func (p *PlatformClient) replayOutbox() {
+	if p.outbox.Len() == 0 || !p.conn.IsConnected() {
+		return
+	}
+
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	sent, err := p.outbox.Replay(p.conn.Publish)
+	if sent > 0 {
+		p.logger.Infof("MQTT发件箱已重发 %d 条消息，剩余 %d 条", sent, p.outbox.Len())
+	}
+	if err != nil {
+		p.logger.WithError(err).Warn("MQTT发件箱重发中断，稍后重试")
+	}
+}
+
+// ConnectionStatus 获取MQTT连接状态
+func (p *PlatformClient) ConnectionStatus() ConnectionStatus {
+	return p.conn.Status()
+}
+
+// OnConnectionStateChange 注册MQTT连接状态变化回调
+func (p *PlatformClient) OnConnectionStateChange(fn func(ConnectionState)) {
+	p.conn.OnStateChange(fn)
+}
+
+// ReconnectMQTT 断开MQTT连接并立即重连
+func (p *PlatformClient) ReconnectMQTT() {
+	p.conn.Reconnect()
+}
+
+// InstanceID 适配器实例ID
+func (p *PlatformClient) InstanceID() string {
+	return p.Config.InstanceID
+}
+
+// OutboxStats 获取MQTT发件箱统计
+func (p *PlatformClient) OutboxStats() OutboxStats {
+	return p.outbox.Stats()
 }
 
 // GetDevice 通过deviceNumber获取设备信息(带缓存)
-func (p *PlatformClient) GetDevice(deviceNumber string) (*types.Device, error) {
+func (p *APIClient) GetDevice(deviceNumber string) (*types.Device, error) {
 	// 先查缓存
-	p.cacheMutex.RLock()
-	if device, ok := p.deviceCache[deviceNumber]; ok && device.ID != "" {
-		p.cacheMutex.RUnlock()
+	if device, missing := p.devices.getByNumber(deviceNumber); device != nil {
 		return device, nil
+	} else if missing {
+		return nil, deviceNotFound(deviceNumber)
 	}
-	p.cacheMutex.RUnlock()
 
 	// 缓存未命中,从平台获取
 	req := &client.DeviceConfigRequest{
@@ -109,48 +253,68 @@ func (p *PlatformClient) GetDevice(deviceNumber string) (*types.Device, error) {
 
 	resp, err := p.sdkClient.Device().GetDeviceConfig(context.Background(), req)
 	if err != nil {
-		return nil, err
+		return nil, wrapRequestError("获取设备信息", err)
 	}
 
 	logrus.Debugf("resp: %+v", resp)
+	if resp.Code != 200 {
+		err := newResponseError("获取设备信息", resp.Code, resp.Message)
+		if errors.Is(err, ErrNotFound) {
+			p.devices.putMissing(missByNumber + deviceNumber)
+		}
+		return nil, err
+	}
 	if resp.Data.ID == "" {
-		return nil, fmt.Errorf("设备不存在: %s", deviceNumber)
+		p.devices.putMissing(missByNumber + deviceNumber)
+		return nil, deviceNotFound(deviceNumber)
 	}
 	logrus.Infof("设备存在: %s", resp.Data)
 
 	// 更新缓存
-	p.cacheMutex.Lock()
-	p.deviceCache[deviceNumber] = &resp.Data
-	p.deviceIDCache[resp.Data.ID] = &resp.Data
-	p.cacheMutex.Unlock()
+	p.devices.put(&resp.Data)
 
 	return &resp.Data, nil
 }
 
+// deviceNotFound 设备不存在错误
+func deviceNotFound(device string) error {
+	return &PlatformError{
+		Op:      "获取设备信息",
+		Message: fmt.Sprintf("设备不存在: %s", device),
+		Kind:    ErrNotFound,
+	}
+}
+
 // 动态注册
-func (p *PlatformClient) DynamicRegister(deviceNumber string) (*types.DeviceDynamicAuthData, error) {
+// deviceName 为空时使用 ServiceIdentifier-deviceNumber
+func (p *APIClient) DynamicRegister(deviceNumber string, deviceName string) (*types.DeviceDynamicAuthData, error) {
+	if deviceName == "" {
+		deviceName = p.Config.ServiceIdentifier + "-" + deviceNumber
+	}
 	req := &client.DeviceDynamicAuthRequest{
 		TemplateSecret: p.Config.TemplateSecret,
 		DeviceNumber:   deviceNumber,
-		DeviceName:     p.Config.ServiceIdentifier + "-" + deviceNumber,
+		DeviceName:     deviceName,
 	}
 
 	resp, err := p.sdkClient.Device().DeviceDynamicAuth(context.Background(), req)
+	// 注册后设备可能已存在，清除之前查询不到的记录
+	p.devices.removeByNumber(deviceNumber)
 	if err != nil {
-		return nil, err
+		return nil, wrapRequestError("直连设备动态注册", err)
 	}
 
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("直连设备动态注册失败: %s", resp.Message)
+		return nil, newResponseError("直连设备动态注册", resp.Code, resp.Message)
 	}
 
 	return &resp.Data, nil
 }
 
 // 子设备动态注册
-func (p *PlatformClient) SubDeviceDynamicRegister(deviceNumber string, subDeviceAddr string, parentDeviceNumber string) (*types.DeviceDynamicAuthData, error) {
+func (p *APIClient) SubDeviceDynamicRegister(deviceNumber string, subDeviceAddr string, parentDeviceNumber string) (*types.DeviceDynamicAuthData, error) {
 	if p.Config.SubTemplateSecret == "" {
-		return nil, fmt.Errorf("子设备模板密钥未配置")
+		return nil, &PlatformError{Op: "子设备动态注册", Message: "子设备模板密钥未配置", Kind: ErrInvalidTemplateSecret}
 	}
 
 	req := &client.DeviceDynamicAuthRequest{
@@ -162,21 +326,23 @@ func (p *PlatformClient) SubDeviceDynamicRegister(deviceNumber string, subDevice
 	}
 
 	resp, err := p.sdkClient.Device().DeviceDynamicAuth(context.Background(), req)
+	// 注册后设备可能已存在，清除之前查询不到的记录
+	p.devices.removeByNumber(deviceNumber)
 	if err != nil {
-		return nil, err
+		return nil, wrapRequestError("子设备动态注册", err)
 	}
 
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("子设备动态注册失败: %s", resp.Message)
+		return nil, newResponseError("子设备动态注册", resp.Code, resp.Message)
 	}
 
 	return &resp.Data, nil
 }
 
 // 网关动态注册
-func (p *PlatformClient) GatewayDynamicRegister(deviceNumber string) (*types.DeviceDynamicAuthData, error) {
+func (p *APIClient) GatewayDynamicRegister(deviceNumber string) (*types.DeviceDynamicAuthData, error) {
 	if p.Config.GatewayTemplateSecret == "" {
-		return nil, fmt.Errorf("网关模板密钥未配置")
+		return nil, &PlatformError{Op: "网关动态注册", Message: "网关模板密钥未配置", Kind: ErrInvalidTemplateSecret}
 	}
 
 	req := &client.DeviceDynamicAuthRequest{
@@ -186,54 +352,60 @@ func (p *PlatformClient) GatewayDynamicRegister(deviceNumber string) (*types.Dev
 	}
 
 	resp, err := p.sdkClient.Device().DeviceDynamicAuth(context.Background(), req)
+	// 注册后设备可能已存在，清除之前查询不到的记录
+	p.devices.removeByNumber(deviceNumber)
 	if err != nil {
-		return nil, err
+		return nil, wrapRequestError("网关动态注册", err)
 	}
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("网关动态注册失败: %s", resp.Message)
+		return nil, newResponseError("网关动态注册", resp.Code, resp.Message)
 	}
 
 	return &resp.Data, nil
 }
 
 // 获取服务接入点列表
-func (p *PlatformClient) GetServiceAccessPoints() ([]types.ServiceAccessRsp, error) {
+func (p *APIClient) GetServiceAccessPoints() ([]types.ServiceAccessRsp, error) {
 	req := &client.ServiceAccessRequest{
 		ServiceIdentifier: p.Config.ServiceIdentifier,
 	}
 	resp, err := p.sdkClient.Service().GetServiceAccessList(context.Background(), req)
 	if err != nil {
-		return nil, err
+		return nil, wrapRequestError("获取服务接入点列表", err)
 	}
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("获取服务接入点列表失败: code=%d, message=%s", resp.Code, resp.Message)
+		return nil, newResponseError("获取服务接入点列表", resp.Code, resp.Message)
 	}
 
 	return resp.Data, nil
 }
 
 // ClearDeviceCache 清理指定设备的缓存
-func (p *PlatformClient) ClearDeviceCache(deviceNumber string) {
-	p.cacheMutex.Lock()
-	// 先获取设备ID用于清理ID缓存
-	if device, exists := p.deviceCache[deviceNumber]; exists {
-		delete(p.deviceIDCache, device.ID)
-	}
-	delete(p.deviceCache, deviceNumber)
-	p.cacheMutex.Unlock()
+func (p *APIClient) ClearDeviceCache(deviceNumber string) {
+	p.devices.removeByNumber(deviceNumber)
 	p.logger.WithField("device_number", deviceNumber).Debug("设备缓存已清理")
 }
 
+// ClearDeviceCacheByID 按设备ID清理缓存，平台修改设备配置后调用
+func (p *APIClient) ClearDeviceCacheByID(deviceID string) {
+	p.devices.removeByID(deviceID)
+	p.logger.WithField("device_id", deviceID).Debug("设备缓存已清理")
+}
+
+// DeviceCacheStats 设备缓存统计
+func (p *APIClient) DeviceCacheStats() DeviceCacheStats {
+	return p.devices.stats()
+}
+
 // GetDeviceByID 通过设备ID查找设备
-func (p *PlatformClient) GetDeviceByID(deviceID string) (*types.Device, error) {
+func (p *APIClient) GetDeviceByID(deviceID string) (*types.Device, error) {
 	// 先查ID缓存
-	p.cacheMutex.RLock()
-	if device, ok := p.deviceIDCache[deviceID]; ok && device.ID != "" {
-		p.cacheMutex.RUnlock()
-		logrus.Infof("设备ID找到，返回: %s", device.DeviceNumber)
+	if device, missing := p.devices.getByID(deviceID); device != nil {
+		logrus.Debugf("设备ID找到，返回: %s", device.DeviceNumber)
 		return device, nil
+	} else if missing {
+		return nil, deviceNotFound(deviceID)
 	}
-	p.cacheMutex.RUnlock()
 
 	logrus.Infof("设备ID未找到，去平台查: %s", deviceID)
 	// 缓存未命中，从平台获取
@@ -242,16 +414,21 @@ func (p *PlatformClient) GetDeviceByID(deviceID string) (*types.Device, error) {
 	}
 	resp, err := p.sdkClient.Device().GetDeviceConfig(context.Background(), req)
 	if err != nil {
-		return nil, err
+		return nil, wrapRequestError("获取设备信息", err)
 	}
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("获取设备信息失败: %s", resp.Message)
+		err := newResponseError("获取设备信息", resp.Code, resp.Message)
+		if errors.Is(err, ErrNotFound) {
+			p.devices.putMissing(missByID + deviceID)
+		}
+		return nil, err
+	}
+	if resp.Data.ID == "" {
+		p.devices.putMissing(missByID + deviceID)
+		return nil, deviceNotFound(deviceID)
 	}
 	// 更新缓存
-	p.cacheMutex.Lock()
-	p.deviceCache[resp.Data.DeviceNumber] = &resp.Data
-	p.deviceIDCache[resp.Data.ID] = &resp.Data
-	p.cacheMutex.Unlock()
+	p.devices.put(&resp.Data)
 	logrus.Infof("设备ID找到，更新缓存: %s", resp.Data.DeviceNumber)
 	return &resp.Data, nil
 }
@@ -280,7 +457,7 @@ func (p *PlatformClient) SendTelemetry(deviceID string, values map[string]interf
 	}
 
 	// 5. 发送消息
-	if err := p.sdkClient.MQTT().Publish("devices/telemetry", 1, string(payload)); err != nil {
+	if _, err := p.publish("devices/telemetry", payload); err != nil {
 		return fmt.Errorf("发送消息失败: %v", err)
 	}
 
@@ -293,9 +470,14 @@ func (p *PlatformClient) SendTelemetry(deviceID string, values map[string]interf
 
 // Close 关闭客户端
 func (p *PlatformClient) Close() {
-	if p.sdkClient != nil {
-		p.sdkClient.Close()
-	}
+	p.closeOnce.Do(func() {
+		close(p.stopCh)
+		if p.conn != nil {
+			p.conn.Close()
+		}
+		p.outbox.Close()
+		p.downlink.stop()
+	})
 }
 
 // SendDeviceStatus 发送设备状态
@@ -308,7 +490,7 @@ func (p *PlatformClient) SendDeviceStatus(deviceID string, status int) error {
 
 	// payload
 	payload := []byte(fmt.Sprintf("%d", status))
-	if err := p.sdkClient.MQTT().Publish("devices/status/"+deviceID, 1, payload); err != nil {
+	if _, err := p.publish("devices/status/"+deviceID, payload); err != nil {
 		return fmt.Errorf("发送状态消息失败: %v", err)
 	}
 
@@ -325,11 +507,31 @@ func (p *PlatformClient) SendDeviceStatus(deviceID string, status int) error {
 }
 
 // SendAttributes 发送设备属性
+// 平台的响应在后台匹配，超时或被拒绝时记录日志；需要确认结果时使用 SendAttributesAndWait
 func (p *PlatformClient) SendAttributes(deviceID string, values map[string]interface{}) error {
+	_, err := p.sendAttributes(deviceID, values)
+	if errors.Is(err, ErrAckQueued) {
+		return nil
+	}
+	return err
+}
+
+// SendAttributesAndWait 发送设备属性并等待平台响应
+// 平台拒绝时返回 ErrRejected，超时返回 ErrAckTimeout，MQTT未连接时返回 ErrAckQueued(消息会在连接恢复后发送)
+func (p *PlatformClient) SendAttributesAndWait(ctx context.Context, deviceID string, values map[string]interface{}) (*AckResult, error) {
+	pending, err := p.sendAttributes(deviceID, values)
+	if err != nil {
+		return nil, err
+	}
+	return pending.wait(ctx)
+}
+
+// sendAttributes 发送设备属性，返回等待中的响应
+func (p *PlatformClient) sendAttributes(deviceID string, values map[string]interface{}) (*pendingAck, error) {
 	// 1. 先将 values 转换为 JSON
 	valuesJSON, err := json.Marshal(values)
 	if err != nil {
-		return fmt.Errorf("序列化values失败: %v", err)
+		return nil, fmt.Errorf("序列化values失败: %v", err)
 	}
 
 	// 2. 将 JSON 进行 base64 编码
@@ -344,28 +546,82 @@ func (p *PlatformClient) SendAttributes(deviceID string, values map[string]inter
 	// 4. 将整个消息转换为 JSON
 	payload, err := json.Marshal(msg)
 	if err != nil {
-		return fmt.Errorf("序列化消息失败: %v", err)
+		return nil, fmt.Errorf("序列化消息失败: %v", err)
 	}
 
 	// 5. 发送消息
-	// 注意：ThingsPanel 的属性上报 topic 需要加上 MessageID
+	// ThingsPanel 的属性上报 topic 需要加上 MessageID，平台按 MessageID 响应
 	// 参考 service-plugin-wvp/mqtt/mqtt_client.go: PublishAttributes
-	timestamp := time.Now().Unix()
-	timestampStr := fmt.Sprintf("%d", timestamp)
-	messageID := timestampStr[len(timestampStr)-7:]
+	messageID, pending, err := p.publishTracked(ackKindAttributes, deviceID, "devices/attributes/", payload)
+	if err != nil && !errors.Is(err, ErrAckQueued) {
+		return nil, fmt.Errorf("发送属性消息失败: %w", err)
+	}
 
-	topic := "devices/attributes/" + messageID
+	p.logger.WithFields(logrus.Fields{
+		"device_id":  deviceID,
+		"message_id": messageID,
+	}).Debug("设备属性发送成功", string(valuesJSON))
+
+	return pending, err
+}
 
-	if err := p.sdkClient.MQTT().Publish(topic, 1, string(payload)); err != nil {
-		return fmt.Errorf("发送属性消息失败: %v", err)
+// SendEvent 发送设备事件，如 stream_started、stream_lost
+// 平台的响应在后台匹配，超时或被拒绝时记录日志；需要确认结果时使用 SendEventAndWait
+func (p *PlatformClient) SendEvent(deviceID, method string, params map[string]interface{}) error {
+	_, err := p.sendEvent(deviceID, method, params)
+	if errors.Is(err, ErrAckQueued) {
+		return nil
 	}
+	return err
+}
 
-	p.logger.WithFields(logrus.Fields{
+// SendEventAndWait 发送设备事件并等待平台响应，错误含义同 SendAttributesAndWait
+func (p *PlatformClient) SendEventAndWait(ctx context.Context, deviceID, method string, params map[string]interface{}) (*AckResult, error) {
+	pending, err := p.sendEvent(deviceID, method, params)
+	if err != nil {
+		return nil, err
+	}
+	return pending.wait(ctx)
+}
+
+// sendEvent 发送设备事件，返回等待中的响应
+// topic: devices/event/{message_id}，values 为 {"method": ..., "params": ...} 的base64编码
+func (p *PlatformClient) sendEvent(deviceID, method string, params map[string]interface{}) (*pendingAck, error) {
+	if method == "" {
+		return nil, fmt.Errorf("事件标识符不能为空")
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	valuesJSON, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化事件失败: %v", err)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
 		"device_id": deviceID,
-		"topic":     topic,
-	}).Debug("设备属性发送成功", string(valuesJSON))
+		"values":    base64.StdEncoding.EncodeToString(valuesJSON),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化消息失败: %v", err)
+	}
 
-	return nil
+	messageID, pending, err := p.publishTracked(ackKindEvent, deviceID, "devices/event/", payload)
+	if err != nil && !errors.Is(err, ErrAckQueued) {
+		return nil, fmt.Errorf("发送事件消息失败: %w", err)
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"device_id":  deviceID,
+		"message_id": messageID,
+		"method":     method,
+	}).Debug("设备事件发送成功", string(valuesJSON))
+
+	return pending, err
 }
 
 // SendHeartbeat 发送插件心跳
@@ -376,11 +632,11 @@ func (p *PlatformClient) SendHeartbeat(ctx context.Context, serviceIdentifier st
 
 	resp, err := p.sdkClient.Service().SendHeartbeat(ctx, req)
 	if err != nil {
-		return fmt.Errorf("发送心跳失败: %v", err)
+		return wrapRequestError("发送心跳", err)
 	}
 
 	if resp.Code != 200 {
-		return fmt.Errorf("心跳响应异常: code=%d, message=%s", resp.Code, resp.Message)
+		return newResponseError("发送心跳", resp.Code, resp.Message)
 	}
 
 	return nil
@@ -408,6 +664,17 @@ func (p *PlatformClient) SetControlProcessor(processor ControlProcessorInterface
 	}
 }
 
+// SetAttributeSetProcessor 设置属性设置处理器
+func (p *PlatformClient) SetAttributeSetProcessor(processor AttributeSetProcessorInterface) {
+	p.attrSetProcessor = processor
+	p.logger.Info("属性设置处理器已设置")
+
+	// 启动MQTT属性设置订阅
+	if err := p.startAttributeSetSubscription(); err != nil {
+		p.logger.WithError(err).Error("启动属性设置订阅失败")
+	}
+}
+
 // startCommandSubscription 启动MQTT指令订阅
 func (p *PlatformClient) startCommandSubscription() error {
 	// 订阅指令主题
@@ -415,7 +682,7 @@ func (p *PlatformClient) startCommandSubscription() error {
 
 	p.logger.Infof("开始订阅指令主题: %s", commandTopic)
 
-	if err := p.sdkClient.MQTT().Subscribe(commandTopic, 1, p.handleCommandMessage); err != nil {
+	if err := p.conn.Subscribe(commandTopic, 1, p.handleCommandMessage); err != nil {
 		return fmt.Errorf("订阅指令主题失败: %v", err)
 	}
 
@@ -424,6 +691,7 @@ func (p *PlatformClient) startCommandSubscription() error {
 }
 
 // handleCommandMessage 处理指令消息
+// 回调中只解析主题和消息体，处理和回复交给下行处理队列
 func (p *PlatformClient) handleCommandMessage(topic string, payload []byte) {
 	p.logger.Debugf("接收到指令消息: topic=%s, payload=%s", topic, string(payload))
 
@@ -442,23 +710,66 @@ func (p *PlatformClient) handleCommandMessage(topic string, payload []byte) {
 	var message CommandMessage
 	if err := json.Unmarshal(payload, &message); err != nil {
 		p.logger.WithError(err).Errorf("解析指令消息失败: %s", string(payload))
+		p.dispatch(deviceID, func() {
+			p.replyCommand(deviceID, messageID, message.Method, nil,
+				&CommandError{Code: CommandErrInvalidParams, Message: "指令消息格式错误"})
+		})
 		return
 	}
 
+	p.dispatch(deviceID, func() {
+		p.processCommand(deviceID, messageID, message)
+	})
+}
+
+// dispatch 将下行消息交给处理队列，队列已满时丢弃并记录日志
+// 不能在MQTT回调中等待或回复，否则会阻塞收包
+func (p *PlatformClient) dispatch(deviceID string, job func()) {
+	if !p.downlink.submit(deviceID, job) {
+		p.logger.Errorf("下行消息处理队列已满或已停止，丢弃消息: deviceID=%s", deviceID)
+	}
+}
+
+// processCommand 执行指令并回复平台
+func (p *PlatformClient) processCommand(deviceID, messageID string, message CommandMessage) {
 	// 检查指令处理器是否已设置
 	if p.commandProcessor == nil {
 		p.logger.Error("指令处理器未设置，无法处理指令")
+		p.replyCommand(deviceID, messageID, message.Method, nil,
+			&CommandError{Code: CommandErrUnsupported, Message: "指令处理器未设置"})
 		return
 	}
 
 	// 处理指令
-	if err := p.commandProcessor.ProcessCommand(deviceID, messageID, message); err != nil {
+	data, err := p.commandProcessor.ProcessCommand(deviceID, messageID, message)
+	if err != nil {
 		p.logger.WithError(err).Errorf("处理指令失败: method=%s, deviceID=%s, messageID=%s",
 			message.Method, deviceID, messageID)
 	} else {
 		p.logger.Infof("指令处理成功: method=%s, deviceID=%s, messageID=%s",
 			message.Method, deviceID, messageID)
 	}
+	p.replyCommand(deviceID, messageID, message.Method, data, err)
+}
+
+// replyCommand 按处理结果回复指令，发送失败只记录日志
+func (p *PlatformClient) replyCommand(deviceID, messageID, method string, data interface{}, err error) {
+	resp := CommandResponse{
+		Method: method,
+		Ts:     time.Now().Unix(),
+		Params: data,
+	}
+	if err != nil {
+		resp.Result = 1
+		resp.ErrCode = commandErrCode(err)
+		resp.Message = err.Error()
+	} else {
+		resp.Message = "success"
+	}
+
+	if sendErr := p.SendCommandResponse(deviceID, messageID, resp); sendErr != nil {
+		p.logger.WithError(sendErr).Errorf("发送指令响应失败: deviceID=%s, messageID=%s", deviceID, messageID)
+	}
 }
 
 // GetCommandProcessor 获取指令处理器
@@ -478,7 +789,7 @@ func (p *PlatformClient) startControlSubscription() error {
 
 	p.logger.Infof("开始订阅控制主题: %s", controlTopic)
 
-	if err := p.sdkClient.MQTT().Subscribe(controlTopic, 1, p.handleControlMessage); err != nil {
+	if err := p.conn.Subscribe(controlTopic, 1, p.handleControlMessage); err != nil {
 		return fmt.Errorf("订阅控制主题失败: %v", err)
 	}
 
@@ -513,10 +824,12 @@ func (p *PlatformClient) handleControlMessage(topic string, payload []byte) {
 		return
 	}
 
-	// 处理控制消息
-	if err := p.controlProcessor.ProcessControl(deviceID, controlData); err != nil {
-		p.logger.WithError(err).Errorf("处理控制消息失败: deviceID=%s", deviceID)
-	} else {
-		p.logger.Infof("控制消息处理成功: deviceID=%s", deviceID)
-	}
+	// 处理控制消息，同一设备的控制按到达顺序执行
+	p.dispatch(deviceID, func() {
+		if err := p.controlProcessor.ProcessControl(deviceID, controlData); err != nil {
+			p.logger.WithError(err).Errorf("处理控制消息失败: deviceID=%s", deviceID)
+		} else {
+			p.logger.Infof("控制消息处理成功: deviceID=%s", deviceID)
+		}
+	})
 }
@@ -0,0 +1,178 @@
+// internal/platform/platformtest/api.go
+package platformtest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"tp-plugin/internal/platform"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// APIServer 模拟 ThingsPanel 插件API，设备和接入点保存在 Platform 中
+// 支持设备配置查询、动态注册、服务接入点列表和心跳
+type APIServer struct {
+	*httptest.Server
+	Platform *Platform
+
+	mu             sync.Mutex
+	templateSecret string // 非空时动态注册校验模板密钥
+	heartbeats     []string
+	heartbeatFail  bool
+}
+
+// NewAPIServer 启动模拟API，测试结束时调用 Close
+func NewAPIServer(p *Platform) *APIServer {
+	s := &APIServer{Platform: p}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/plugin/device/config", s.handleDeviceConfig)
+	mux.HandleFunc("/api/v1/device/auth", s.handleDeviceAuth)
+	mux.HandleFunc("/api/v1/plugin/service/access/list", s.handleAccessList)
+	mux.HandleFunc("/api/v1/plugin/heartbeat", s.handleHeartbeat)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// RequireTemplateSecret 动态注册时校验模板密钥
+func (s *APIServer) RequireTemplateSecret(secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templateSecret = secret
+}
+
+// Heartbeats 收到心跳的服务标识符
+func (s *APIServer) Heartbeats() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.heartbeats...)
+}
+
+// FailHeartbeats 心跳接口返回500，模拟平台无响应
+func (s *APIServer) FailHeartbeats(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeatFail = fail
+}
+
+// apiResponse 平台API的统一响应格式
+type apiResponse struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (s *APIServer) handleDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DeviceID     string `json:"device_id"`
+		DeviceNumber string `json:"device_number"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	var device *types.Device
+	var err error
+	if req.DeviceID != "" {
+		device, err = s.Platform.GetDeviceByID(req.DeviceID)
+	} else {
+		device, err = s.Platform.GetDevice(req.DeviceNumber)
+	}
+	if err != nil {
+		reply(w, apiResponse{Code: 400, Message: "设备不存在"})
+		return
+	}
+	reply(w, apiResponse{Code: 200, Message: "success", Data: device})
+}
+
+func (s *APIServer) handleDeviceAuth(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TemplateSecret     string `json:"template_secret"`
+		DeviceNumber       string `json:"device_number"`
+		DeviceName         string `json:"device_name"`
+		SubDeviceAddr      string `json:"sub_device_addr"`
+		ParentDeviceNumber string `json:"parent_device_number"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	secret := s.templateSecret
+	s.mu.Unlock()
+	if secret != "" && req.TemplateSecret != secret {
+		reply(w, apiResponse{Code: 400, Message: "模板密钥无效"})
+		return
+	}
+
+	var data *types.DeviceDynamicAuthData
+	var err error
+	if req.ParentDeviceNumber != "" {
+		data, err = s.Platform.SubDeviceDynamicRegister(req.DeviceNumber, req.SubDeviceAddr, req.ParentDeviceNumber)
+	} else {
+		data, err = s.Platform.DynamicRegister(req.DeviceNumber, req.DeviceName)
+	}
+	switch {
+	case errors.Is(err, platform.ErrAlreadyExists):
+		reply(w, apiResponse{Code: 400, Message: "设备已存在"})
+	case err != nil:
+		reply(w, apiResponse{Code: 400, Message: err.Error()})
+	default:
+		reply(w, apiResponse{Code: 200, Message: "操作成功", Data: data})
+	}
+}
+
+func (s *APIServer) handleAccessList(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ServiceIdentifier string `json:"service_identifier"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	accessPoints, _ := s.Platform.GetServiceAccessPoints()
+	if accessPoints == nil {
+		accessPoints = []types.ServiceAccessRsp{}
+	}
+	reply(w, apiResponse{Code: 200, Message: "success", Data: accessPoints})
+}
+
+func (s *APIServer) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ServiceIdentifier string `json:"service_identifier"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	fail := s.heartbeatFail
+	if !fail {
+		s.heartbeats = append(s.heartbeats, req.ServiceIdentifier)
+	}
+	s.mu.Unlock()
+	if fail {
+		http.Error(w, "platform unavailable", http.StatusInternalServerError)
+		return
+	}
+	reply(w, apiResponse{Code: 200, Message: "success"})
+}
+
+// decode 解析POST请求体，失败时直接回复错误
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,337 @@
+// internal/platform/platformtest/platform.go
+
+// Package platformtest 提供内存中的平台实现，用于离线测试设备同步与通知处理
+package platformtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"tp-plugin/internal/platform"
+
+	"github.com/ThingsPanel/tp-protocol-sdk-go/types"
+)
+
+// Registration 一次动态注册请求
+type Registration struct {
+	DeviceNumber       string
+	DeviceName         string
+	SubDeviceAddr      string // 子设备注册时的通道地址
+	ParentDeviceNumber string // 子设备注册时的网关设备编号
+	Created            bool   // false 表示设备已存在
+}
+
+// Report 一次遥测或属性上报
+type Report struct {
+	DeviceID string
+	Values   map[string]interface{}
+}
+
+// Status 一次设备状态上报
+type Status struct {
+	DeviceID string
+	Status   int
+}
+
+// Event 一次设备事件上报
+type Event struct {
+	DeviceID string
+	Method   string
+	Params   map[string]interface{}
+}
+
+// Platform 记录全部上报内容的内存平台，实现 platform.Client
+type Platform struct {
+	mu            sync.Mutex
+	devices       map[string]*types.Device // key为deviceNumber
+	nextID        int
+	accessPoints  []types.ServiceAccessRsp
+	registerErrs  map[string]error // 设备编号 -> 注册时返回的错误
+	registrations []Registration
+	telemetry     []Report
+	attributes    []Report
+	statuses      []Status
+	events        []Event
+}
+
+var _ platform.Client = (*Platform)(nil)
+
+// New 创建空的内存平台
+func New() *Platform {
+	return &Platform{
+		devices:      make(map[string]*types.Device),
+		registerErrs: make(map[string]error),
+	}
+}
+
+// AddDevice 预置平台中已存在的设备，ID为空时自动生成
+func (p *Platform) AddDevice(device types.Device) *types.Device {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.addLocked(device)
+}
+
+func (p *Platform) addLocked(device types.Device) *types.Device {
+	if device.ID == "" {
+		p.nextID++
+		device.ID = fmt.Sprintf("device-%d", p.nextID)
+	}
+	p.devices[device.DeviceNumber] = &device
+	return copyDevice(&device)
+}
+
+// UpdateVoucher 修改设备凭证，模拟在平台上编辑设备
+func (p *Platform) UpdateVoucher(deviceNumber, voucher string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if device, ok := p.devices[deviceNumber]; ok {
+		device.Voucher = voucher
+	}
+}
+
+// RemoveDevice 删除设备，模拟在平台上删除设备
+func (p *Platform) RemoveDevice(deviceNumber string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.devices, deviceNumber)
+}
+
+// SetAccessPoints 设置服务接入点列表
+func (p *Platform) SetAccessPoints(accessPoints ...types.ServiceAccessRsp) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accessPoints = append([]types.ServiceAccessRsp(nil), accessPoints...)
+}
+
+// FailRegister 设备注册时返回指定错误，err 为nil时恢复正常
+func (p *Platform) FailRegister(deviceNumber string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		delete(p.registerErrs, deviceNumber)
+		return
+	}
+	p.registerErrs[deviceNumber] = err
+}
+
+// Device 按设备编号查询设备
+func (p *Platform) Device(deviceNumber string) (*types.Device, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	device, ok := p.devices[deviceNumber]
+	if !ok {
+		return nil, false
+	}
+	return copyDevice(device), true
+}
+
+// Devices 全部设备，按设备编号排序
+func (p *Platform) Devices() []types.Device {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := make([]types.Device, 0, len(p.devices))
+	for _, device := range p.devices {
+		result = append(result, *device)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DeviceNumber < result[j].DeviceNumber })
+	return result
+}
+
+// Registrations 全部注册请求
+func (p *Platform) Registrations() []Registration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Registration(nil), p.registrations...)
+}
+
+// Telemetry 全部遥测上报
+func (p *Platform) Telemetry() []Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Report(nil), p.telemetry...)
+}
+
+// Attributes 全部属性上报
+func (p *Platform) Attributes() []Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Report(nil), p.attributes...)
+}
+
+// Statuses 全部状态上报
+func (p *Platform) Statuses() []Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Status(nil), p.statuses...)
+}
+
+// Events 全部事件上报
+func (p *Platform) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
+
+// LastStatus 设备最后一次上报的状态
+func (p *Platform) LastStatus(deviceID string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.statuses) - 1; i >= 0; i-- {
+		if p.statuses[i].DeviceID == deviceID {
+			return p.statuses[i].Status, true
+		}
+	}
+	return 0, false
+}
+
+// AttributeValues 设备上报过的属性，后上报的值覆盖先上报的值
+func (p *Platform) AttributeValues(deviceID string) map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	values := make(map[string]interface{})
+	for _, report := range p.attributes {
+		if report.DeviceID != deviceID {
+			continue
+		}
+		for k, v := range report.Values {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// EventsFor 设备上报过的指定事件
+func (p *Platform) EventsFor(deviceID, method string) []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var result []Event
+	for _, event := range p.events {
+		if event.DeviceID == deviceID && event.Method == method {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// GetDevice 通过deviceNumber获取设备信息
+func (p *Platform) GetDevice(deviceNumber string) (*types.Device, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if device, ok := p.devices[deviceNumber]; ok {
+		return copyDevice(device), nil
+	}
+	return nil, notFound(deviceNumber)
+}
+
+// GetDeviceByID 通过设备ID查找设备
+func (p *Platform) GetDeviceByID(deviceID string) (*types.Device, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, device := range p.devices {
+		if device.ID == deviceID {
+			return copyDevice(device), nil
+		}
+	}
+	return nil, notFound(deviceID)
+}
+
+// ClearDeviceCache 内存平台没有缓存
+func (p *Platform) ClearDeviceCache(string) {}
+
+// ClearDeviceCacheByID 内存平台没有缓存
+func (p *Platform) ClearDeviceCacheByID(string) {}
+
+// DynamicRegister 直连设备动态注册
+func (p *Platform) DynamicRegister(deviceNumber string, deviceName string) (*types.DeviceDynamicAuthData, error) {
+	return p.register(Registration{DeviceNumber: deviceNumber, DeviceName: deviceName}, "直连设备动态注册")
+}
+
+// SubDeviceDynamicRegister 子设备动态注册
+func (p *Platform) SubDeviceDynamicRegister(deviceNumber string, subDeviceAddr string, parentDeviceNumber string) (*types.DeviceDynamicAuthData, error) {
+	return p.register(Registration{
+		DeviceNumber:       deviceNumber,
+		SubDeviceAddr:      subDeviceAddr,
+		ParentDeviceNumber: parentDeviceNumber,
+	}, "子设备动态注册")
+}
+
+func (p *Platform) register(reg Registration, op string) (*types.DeviceDynamicAuthData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err, ok := p.registerErrs[reg.DeviceNumber]; ok {
+		p.registrations = append(p.registrations, reg)
+		return nil, err
+	}
+	if _, exists := p.devices[reg.DeviceNumber]; exists {
+		p.registrations = append(p.registrations, reg)
+		return nil, &platform.PlatformError{Op: op, Code: 400, Message: "设备已存在", Kind: platform.ErrAlreadyExists}
+	}
+
+	reg.Created = true
+	p.registrations = append(p.registrations, reg)
+	device := p.addLocked(types.Device{DeviceNumber: reg.DeviceNumber})
+	return &types.DeviceDynamicAuthData{DeviceID: device.ID}, nil
+}
+
+// GetServiceAccessPoints 获取服务接入点列表
+func (p *Platform) GetServiceAccessPoints() ([]types.ServiceAccessRsp, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]types.ServiceAccessRsp(nil), p.accessPoints...), nil
+}
+
+// SendDeviceStatus 记录设备状态
+func (p *Platform) SendDeviceStatus(deviceID string, status int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.statuses = append(p.statuses, Status{DeviceID: deviceID, Status: status})
+	return nil
+}
+
+// SendTelemetry 记录遥测
+func (p *Platform) SendTelemetry(deviceID string, values map[string]interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.telemetry = append(p.telemetry, Report{DeviceID: deviceID, Values: copyValues(values)})
+	return nil
+}
+
+// SendAttributes 记录属性
+func (p *Platform) SendAttributes(deviceID string, values map[string]interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attributes = append(p.attributes, Report{DeviceID: deviceID, Values: copyValues(values)})
+	return nil
+}
+
+// SendEvent 记录事件
+func (p *Platform) SendEvent(deviceID, method string, params map[string]interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, Event{DeviceID: deviceID, Method: method, Params: copyValues(params)})
+	return nil
+}
+
+// copyDevice 返回副本，避免调用方修改内存平台中的设备
+func copyDevice(device *types.Device) *types.Device {
+	c := *device
+	return &c
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+func notFound(device string) error {
+	return &platform.PlatformError{
+		Op:      "获取设备信息",
+		Message: fmt.Sprintf("设备不存在: %s", device),
+		Kind:    platform.ErrNotFound,
+	}
+}
@@ -0,0 +1,535 @@
+// internal/protocol/plugins/go2rtc/access_point.go
+package go2rtc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	formjson "tp-plugin/internal/form_json"
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 接入点列表刷新间隔
+const accessPointReloadInterval = 5 * time.Minute
+
+// accessPointSync 单个接入点的同步服务及其凭证
+type accessPointSync struct {
+	name    string
+	voucher string // 原始凭证，用于判断配置是否变化
+	config  formjson.SVCRForm
+	service *DeviceSyncService
+}
+
+// SyncManager 按服务接入点管理设备同步服务
+// 每个启用自动同步的接入点对应一个go2rtc客户端和一个同步服务
+type SyncManager struct {
+	platformClient platform.Client
+	logger         *logrus.Logger
+	defaults       SyncOptions  // 各接入点共用的同步选项，接入点相关字段由凭证覆盖
+	devices        *deviceIndex // 已注册设备的ID索引，重新加载后保留
+
+	reloadMu   sync.Mutex // 串行化重新加载，定时刷新、配置通知和恢复可能同时触发
+	mu         sync.Mutex
+	points     map[string]*accessPointSync  // 接入点ID -> 同步服务
+	configs    map[string]formjson.SVCRForm // 最近一次加载的全部接入点凭证
+	lastReload *ReloadResult
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewSyncManager 创建接入点同步管理器
+func NewSyncManager(platformClient platform.Client, logger *logrus.Logger, defaults SyncOptions) *SyncManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SyncManager{
+		platformClient: platformClient,
+		logger:         logger,
+		defaults:       defaults,
+		devices:        newDeviceIndex(),
+		points:         make(map[string]*accessPointSync),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Start 加载接入点并定期刷新
+func (m *SyncManager) Start() {
+	if err := m.Reload(); err != nil {
+		m.logger.WithError(err).Error("加载服务接入点失败")
+	}
+
+	go func() {
+		ticker := time.NewTicker(accessPointReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Reload(); err != nil {
+					m.logger.WithError(err).Error("刷新服务接入点失败")
+				}
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止全部同步服务
+func (m *SyncManager) Stop() {
+	m.cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, p := range m.points {
+		p.service.Stop()
+		delete(m.points, id)
+	}
+}
+
+// ReloadResult 一次接入点重新加载的结果，各列表为接入点ID
+type ReloadResult struct {
+	Trigger   string    `json:"trigger"`
+	At        time.Time `json:"at"`
+	Total     int       `json:"total"`
+	Created   []string  `json:"created"`   // 新建同步服务
+	Rebuilt   []string  `json:"rebuilt"`   // 凭证变化，重建go2rtc客户端和同步服务
+	Disabled  []string  `json:"disabled"`  // 未启用自动同步，运行中的同步服务已停止
+	Removed   []string  `json:"removed"`   // 接入点已删除
+	Failed    []string  `json:"failed"`    // 凭证或过滤规则无效
+	Unchanged []string  `json:"unchanged"` // 凭证未变化
+	Error     string    `json:"error,omitempty"`
+}
+
+// 重新加载的触发方式
+const (
+	ReloadTriggerSchedule     = "schedule"     // 启动和定期刷新
+	ReloadTriggerNotification = "notification" // 平台服务配置修改通知
+	ReloadTriggerRecovery     = "recovery"     // 平台心跳连续失败后的恢复
+)
+
+// Reload 从平台重新加载接入点，按凭证变化创建、重建或停止同步服务
+func (m *SyncManager) Reload() error {
+	_, err := m.reload(ReloadTriggerSchedule)
+	return err
+}
+
+// ApplyServiceConfig 平台通知服务配置修改后立即重新加载接入点
+// accessPointID 为通知中的接入点，仅用于日志，平台接口按服务返回全部接入点
+func (m *SyncManager) ApplyServiceConfig(accessPointID string) (ReloadResult, error) {
+	logger := m.logger.WithField("access_point", accessPointID)
+	logger.Info("服务配置已修改，重新加载接入点")
+
+	result, err := m.reload(ReloadTriggerNotification)
+	if err != nil {
+		logger.WithError(err).Error("服务配置修改后重新加载接入点失败")
+		return result, err
+	}
+	if accessPointID != "" {
+		if _, ok := m.AccessPointConfig(accessPointID); !ok {
+			logger.Warn("通知中的接入点不在服务接入点列表中")
+		}
+	}
+	return result, nil
+}
+
+// LastReload 最近一次重新加载的结果
+func (m *SyncManager) LastReload() (ReloadResult, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastReload == nil {
+		return ReloadResult{}, false
+	}
+	return *m.lastReload, true
+}
+
+// AccessPointConfig 获取最近一次加载的接入点凭证，含未启用自动同步的接入点
+func (m *SyncManager) AccessPointConfig(accessPointID string) (formjson.SVCRForm, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	voucher, ok := m.configs[accessPointID]
+	return voucher, ok
+}
+
+// reload 重新加载接入点并记录结果
+// 首轮同步在释放锁之后执行，期间指令、控制和状态查询不受影响
+func (m *SyncManager) reload(trigger string) (ReloadResult, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	result := ReloadResult{
+		Trigger:   trigger,
+		At:        time.Now(),
+		Created:   []string{},
+		Rebuilt:   []string{},
+		Disabled:  []string{},
+		Removed:   []string{},
+		Failed:    []string{},
+		Unchanged: []string{},
+	}
+
+	accessPoints, err := m.platformClient.GetServiceAccessPoints()
+	if err != nil {
+		result.Error = err.Error()
+		m.mu.Lock()
+		m.lastReload = &result
+		m.mu.Unlock()
+		return result, err
+	}
+
+	m.mu.Lock()
+	result.Total = len(accessPoints)
+	var started []*DeviceSyncService
+	configs := make(map[string]formjson.SVCRForm, len(accessPoints))
+	for _, ap := range accessPoints {
+		logger := m.logger.WithField("access_point", ap.ID)
+
+		existing, running := m.points[ap.ID]
+		if running && existing.voucher == ap.Voucher {
+			configs[ap.ID] = existing.config
+			result.Unchanged = append(result.Unchanged, ap.ID)
+			continue
+		}
+		if running {
+			existing.service.Stop()
+			delete(m.points, ap.ID)
+		}
+
+		voucher, err := ParseAccessPointVoucher(ap.Voucher)
+		if err != nil {
+			logger.WithError(err).Error("解析接入点凭证失败")
+			result.Failed = append(result.Failed, ap.ID)
+			continue
+		}
+		configs[ap.ID] = voucher
+		if !voucher.AutoSyncEnabled() {
+			if running {
+				logger.Info("接入点已关闭自动同步，停止同步服务")
+				result.Disabled = append(result.Disabled, ap.ID)
+			} else {
+				logger.Debug("接入点未启用自动同步")
+			}
+			continue
+		}
+
+		service, err := m.newSyncService(ap.ID, voucher)
+		if err != nil {
+			logger.WithError(err).Error("创建同步服务失败")
+			result.Failed = append(result.Failed, ap.ID)
+			continue
+		}
+		started = append(started, service)
+		m.points[ap.ID] = &accessPointSync{
+			name:    ap.Name,
+			voucher: ap.Voucher,
+			config:  voucher,
+			service: service,
+		}
+
+		entry := logger.WithFields(logrus.Fields{
+			"go2rtc_url":    service.handler.APIURL(),
+			"sync_interval": service.syncInterval.String(),
+			"auth":          service.handler.AuthEnabled(),
+		})
+		if running {
+			entry.Info("接入点配置已变化，已重建go2rtc客户端和同步服务")
+			result.Rebuilt = append(result.Rebuilt, ap.ID)
+		} else {
+			entry.Info("接入点同步服务已启动")
+			result.Created = append(result.Created, ap.ID)
+		}
+	}
+
+	for id, p := range m.points {
+		if _, ok := configs[id]; ok {
+			continue
+		}
+		// 凭证无法解析的接入点已在上面停止，这里只剩平台已删除的接入点
+		p.service.Stop()
+		delete(m.points, id)
+		m.logger.WithField("access_point", id).Info("接入点已删除，停止同步服务")
+		result.Removed = append(result.Removed, id)
+	}
+	m.configs = configs
+	m.lastReload = &result
+
+	m.logger.WithFields(logrus.Fields{
+		"trigger":   trigger,
+		"created":   len(result.Created),
+		"rebuilt":   len(result.Rebuilt),
+		"disabled":  len(result.Disabled),
+		"removed":   len(result.Removed),
+		"failed":    len(result.Failed),
+		"unchanged": len(result.Unchanged),
+	}).Infof("服务接入点已加载: 共%d个，同步中%d个", len(accessPoints), len(m.points))
+	m.mu.Unlock()
+
+	for _, service := range started {
+		service.Start()
+	}
+	return result, nil
+}
+
+// newSyncService 按接入点凭证创建同步服务
+func (m *SyncManager) newSyncService(accessPointID string, voucher formjson.SVCRForm) (*DeviceSyncService, error) {
+	filter, err := NewStreamFilter(FilterConfigFromVoucher(voucher))
+	if err != nil {
+		return nil, err
+	}
+
+	handler := NewHandler(0).WithVoucher(voucher)
+
+	opts := m.defaults
+	opts.AccessPointID = accessPointID
+	opts.SyncIntervalSec = int(voucher.SyncInterval)
+	opts.Filter = filter
+	service := NewDeviceSyncService(handler, m.platformClient, m.logger, opts)
+	service.devices = m.devices
+	return service, nil
+}
+
+// NVRs 已知的NVR记录，为nil表示没有配置
+func (m *SyncManager) NVRs() *NVRRegistry {
+	return m.defaults.NVRs
+}
+
+// GetService 获取指定接入点的同步服务
+func (m *SyncManager) GetService(accessPointID string) (*DeviceSyncService, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.points[accessPointID]
+	if !ok {
+		return nil, false
+	}
+	return p.service, true
+}
+
+// Services 获取全部运行中的同步服务
+func (m *SyncManager) Services() []*DeviceSyncService {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	services := make([]*DeviceSyncService, 0, len(m.points))
+	for _, p := range m.points {
+		services = append(services, p.service)
+	}
+	return services
+}
+
+// LookupDevice 按注册时记录的设备ID索引查找流名称及所属接入点的同步服务
+// 不访问平台，设备已从平台删除时仍可找到；接入点已不存在时 service 为nil
+func (m *SyncManager) LookupDevice(deviceID string) (*DeviceSyncService, string, bool) {
+	ref, ok := m.devices.get(deviceID)
+	if !ok {
+		return nil, "", false
+	}
+	service, _ := m.GetService(ref.accessPointID)
+	return service, ref.stream, true
+}
+
+// DeviceHandler 选择设备配置通知中的流应写入的go2rtc客户端
+// 依次按设备ID索引、已同步或已存在该流的接入点查找，只有一个接入点时使用该接入点；无法确定时返回false
+func (m *SyncManager) DeviceHandler(deviceID, stream string) (*Go2RTCProtocolHandler, bool) {
+	if service, _, ok := m.LookupDevice(deviceID); ok && service != nil {
+		return service.handler, true
+	}
+
+	services := m.Services()
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].AccessPointID() < services[j].AccessPointID()
+	})
+	for _, service := range services {
+		if service.isSynced(stream) {
+			return service.handler, true
+		}
+	}
+	for _, service := range services {
+		if _, err := service.handler.GetStream(stream); err == nil {
+			return service.handler, true
+		}
+	}
+	if len(services) == 1 {
+		return services[0].handler, true
+	}
+	return nil, false
+}
+
+// ResolveDevice 根据平台设备ID查找对应的流名称及所属接入点的同步服务
+// 优先匹配已同步或有控制记录的设备，其余(如刚添加的流)再到各接入点的go2rtc中查找
+func (m *SyncManager) ResolveDevice(deviceID string) (*DeviceSyncService, string, error) {
+	device, err := m.platformClient.GetDeviceByID(deviceID)
+	if err != nil {
+		return nil, "", err
+	}
+	name := device.DeviceNumber
+
+	services := m.Services()
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].AccessPointID() < services[j].AccessPointID()
+	})
+	for _, service := range services {
+		if service.isSynced(name) || m.defaults.Controls.Has(service.AccessPointID(), name) {
+			return service, name, nil
+		}
+	}
+	for _, service := range services {
+		if _, err := service.handler.GetStream(name); err == nil {
+			return service, name, nil
+		}
+	}
+	return nil, name, fmt.Errorf("%w: %s", ErrStreamNotFound, name)
+}
+
+// Trigger 立即触发指定接入点的同步
+func (m *SyncManager) Trigger(accessPointID string) (SyncJob, error) {
+	service, ok := m.GetService(accessPointID)
+	if !ok {
+		return SyncJob{}, fmt.Errorf("接入点不存在或未启用自动同步: %s", accessPointID)
+	}
+	return service.Trigger(), nil
+}
+
+// TriggerConfigChanged go2rtc配置文件变化时触发相关接入点同步
+// accessPointIDs 为空时触发go2rtc地址指向本机的接入点；各接入点在go2rtc API反映变化后再同步
+func (m *SyncManager) TriggerConfigChanged(accessPointIDs []string, change StreamsChange) {
+	wanted := make(map[string]bool, len(accessPointIDs))
+	for _, id := range accessPointIDs {
+		wanted[id] = true
+	}
+
+	triggered := 0
+	for _, service := range m.Services() {
+		if len(wanted) > 0 {
+			if !wanted[service.AccessPointID()] {
+				continue
+			}
+		} else if !IsLocalAPIURL(service.handler.APIURL()) {
+			continue
+		}
+		go service.syncAfterConfigChange(change)
+		triggered++
+	}
+	if triggered == 0 {
+		m.logger.Warn("go2rtc配置文件已变化，但没有匹配的接入点同步服务")
+	}
+}
+
+// Job 在全部接入点中查询手动或文件变化触发的同步任务
+func (m *SyncManager) Job(id string) (SyncJob, bool) {
+	for _, service := range m.Services() {
+		if job, ok := service.Job(id); ok {
+			return job, true
+		}
+	}
+	return SyncJob{}, false
+}
+
+// Statuses 获取全部接入点的同步状态
+func (m *SyncManager) Statuses() []SyncStatus {
+	services := m.Services()
+	statuses := make([]SyncStatus, 0, len(services))
+	for _, service := range services {
+		statuses = append(statuses, service.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].AccessPointID < statuses[j].AccessPointID
+	})
+	return statuses
+}
+
+// DeadLetters 获取全部接入点的死信设备
+func (m *SyncManager) DeadLetters() []DeadLetter {
+	result := make([]DeadLetter, 0)
+	for _, service := range m.Services() {
+		result = append(result, service.DeadLetters()...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AccessPointID != result[j].AccessPointID {
+			return result[i].AccessPointID < result[j].AccessPointID
+		}
+		return result[i].StreamName < result[j].StreamName
+	})
+	return result
+}
+
+// ParseAccessPointVoucher 解析服务接入点凭证
+func ParseAccessPointVoucher(raw string) (formjson.SVCRForm, error) {
+	var voucher formjson.SVCRForm
+	if raw == "" {
+		return voucher, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &voucher); err != nil {
+		return voucher, fmt.Errorf("解析接入点凭证失败: %v", err)
+	}
+	return voucher, nil
+}
+
+// FilterConfigFromVoucher 从接入点凭证生成过滤规则配置
+func FilterConfigFromVoucher(voucher formjson.SVCRForm) StreamFilterConfig {
+	return StreamFilterConfig{
+		Include:     SplitPatterns(voucher.Include),
+		Exclude:     SplitPatterns(voucher.Exclude),
+		Marker:      voucher.Marker,
+		SkipAliases: voucher.SkipAliasesEnabled(),
+	}
+}
+
+// deviceRef 设备对应的接入点和流
+type deviceRef struct {
+	accessPointID string
+	stream        string
+}
+
+// deviceIndex 平台设备ID到流的索引，在注册设备时记录
+// 平台删除设备后按ID已查不到设备编号，清理时依赖此索引找到流
+type deviceIndex struct {
+	mu   sync.RWMutex
+	refs map[string]deviceRef
+}
+
+func newDeviceIndex() *deviceIndex {
+	return &deviceIndex{refs: make(map[string]deviceRef)}
+}
+
+// put 记录设备ID对应的流，同一流换了设备ID时移除旧记录
+func (d *deviceIndex) put(deviceID, accessPointID, stream string) {
+	if d == nil || deviceID == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, ref := range d.refs {
+		if id != deviceID && ref.accessPointID == accessPointID && ref.stream == stream {
+			delete(d.refs, id)
+		}
+	}
+	d.refs[deviceID] = deviceRef{accessPointID: accessPointID, stream: stream}
+}
+
+func (d *deviceIndex) get(deviceID string) (deviceRef, bool) {
+	if d == nil {
+		return deviceRef{}, false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ref, ok := d.refs[deviceID]
+	return ref, ok
+}
+
+// remove 移除接入点中某个流的记录
+func (d *deviceIndex) remove(accessPointID, stream string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, ref := range d.refs {
+		if ref.accessPointID == accessPointID && ref.stream == stream {
+			delete(d.refs, id)
+		}
+	}
+}
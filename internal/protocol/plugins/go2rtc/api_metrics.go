@@ -0,0 +1,35 @@
+// internal/protocol/plugins/go2rtc/api_metrics.go
+package go2rtc
+
+import (
+	"net/http"
+	"time"
+
+	"tp-plugin/internal/pkg/metrics"
+)
+
+// apiTransport 记录go2rtc API的请求数、失败数和耗时，设置了用户名时附加Basic认证
+// 流不存在等4xx属于正常业务结果，只有连接失败和5xx计为失败
+// MP4等长连接请求的耗时为收到响应头的时间
+type apiTransport struct {
+	next     http.RoundTripper
+	username string
+	password string
+}
+
+func (t apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.username != "" {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(t.username, t.password)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	metrics.Go2RTCRequests.Add(1)
+	metrics.Go2RTCLatencyMs.Add(float64(time.Since(start).Microseconds()) / 1000)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		metrics.Go2RTCErrors.Add(1)
+	}
+	return resp, err
+}
@@ -0,0 +1,237 @@
+// internal/protocol/plugins/go2rtc/command.go
+package go2rtc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 平台下发的指令
+const (
+	CommandAddSource     = "add_source"      // 为流追加一个源地址，params: {"source": "rtsp://..."}
+	CommandRemoveStream  = "remove_stream"   // 从go2rtc删除流
+	CommandRestartStream = "restart_stream"  // 以原有源地址重建流，断开后重新拉流
+	CommandGetStreamInfo = "get_stream_info" // 查询源地址、编码及连接数
+	CommandSnapshot      = "snapshot"        // 抓取当前画面，以base64返回
+)
+
+// 抓图结果通过MQTT返回，过大的图片会被平台拒绝
+const maxSnapshotBytes = 1 << 20
+
+// CommandProcessor go2rtc设备指令处理器
+// 按设备ID找到所属接入点的go2rtc，执行后由平台客户端回复指令结果
+type CommandProcessor struct {
+	manager *SyncManager
+	logger  *logrus.Logger
+}
+
+// NewCommandProcessor 创建指令处理器
+func NewCommandProcessor(manager *SyncManager, logger *logrus.Logger) *CommandProcessor {
+	return &CommandProcessor{
+		manager: manager,
+		logger:  logger,
+	}
+}
+
+// ProcessCommand 处理平台下发的指令
+func (c *CommandProcessor) ProcessCommand(deviceID, messageID string, message platform.CommandMessage) (interface{}, error) {
+	params, err := commandParams(message.Params)
+	if err != nil {
+		return nil, platform.NewCommandError(platform.CommandErrInvalidParams, err, "指令参数格式错误")
+	}
+
+	switch message.Method {
+	case CommandAddSource, CommandRemoveStream, CommandRestartStream, CommandGetStreamInfo, CommandSnapshot:
+	default:
+		return nil, platform.NewCommandError(platform.CommandErrUnsupported, nil, "不支持的指令: %s", message.Method)
+	}
+
+	service, name, err := c.manager.ResolveDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, ErrStreamNotFound) || errors.Is(err, platform.ErrNotFound) {
+			return nil, platform.NewCommandError(platform.CommandErrNotFound, err, "设备对应的流不存在")
+		}
+		return nil, platform.NewCommandError(platform.CommandErrInternal, err, "查找设备失败")
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"device_id":    deviceID,
+		"message_id":   messageID,
+		"method":       message.Method,
+		"stream":       name,
+		"access_point": service.AccessPointID(),
+	}).Info("执行go2rtc指令")
+
+	handler := service.handler
+	switch message.Method {
+	case CommandAddSource:
+		return c.addSource(handler, name, params)
+	case CommandRemoveStream:
+		return c.removeStream(service, name)
+	case CommandRestartStream:
+		return c.restartStream(handler, name)
+	case CommandGetStreamInfo:
+		return c.streamInfo(handler, name)
+	default:
+		return c.snapshot(handler, name)
+	}
+}
+
+// addSource 为流追加源地址，已存在的源地址不重复添加
+func (c *CommandProcessor) addSource(handler *Go2RTCProtocolHandler, name string, params map[string]interface{}) (interface{}, error) {
+	source := stringParam(params, "source", "url")
+	if source == "" {
+		return nil, platform.NewCommandError(platform.CommandErrInvalidParams, nil, "缺少参数 source")
+	}
+	if u, err := url.Parse(source); err != nil || u.Scheme == "" {
+		return nil, platform.NewCommandError(platform.CommandErrInvalidParams, err, "源地址格式错误")
+	}
+
+	sources, err := streamSources(handler, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range sources {
+		if existing == source {
+			return map[string]interface{}{"stream": name, "sources": len(sources)}, nil
+		}
+	}
+
+	sources = append(sources, source)
+	if err := handler.SetStreamSources(name, sources); err != nil {
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, err, "添加源地址失败")
+	}
+	return map[string]interface{}{"stream": name, "sources": len(sources)}, nil
+}
+
+// removeStream 删除流，下一轮同步按下线策略处理对应设备
+func (c *CommandProcessor) removeStream(service *DeviceSyncService, name string) (interface{}, error) {
+	if err := service.handler.RemoveStream(name); err != nil {
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, err, "删除流失败")
+	}
+	job := service.Trigger()
+	return map[string]interface{}{"stream": name, "sync_job": job.ID}, nil
+}
+
+// restartStream 以原有源地址重建流
+func (c *CommandProcessor) restartStream(handler *Go2RTCProtocolHandler, name string) (interface{}, error) {
+	sources, err := streamSources(handler, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, platform.NewCommandError(platform.CommandErrNotFound, nil, "流没有可用的源地址")
+	}
+	if err := handler.SetStreamSources(name, sources); err != nil {
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, err, "重启流失败")
+	}
+	return map[string]interface{}{"stream": name, "sources": len(sources)}, nil
+}
+
+// streamInfo 查询流状态，源地址隐藏密码
+func (c *CommandProcessor) streamInfo(handler *Go2RTCProtocolHandler, name string) (interface{}, error) {
+	state, err := getStream(handler, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]string, 0, len(state.Sources))
+	for _, src := range state.Sources {
+		sources = append(sources, redactURL(src))
+	}
+	return map[string]interface{}{
+		"stream":    name,
+		"sources":   sources,
+		"codecs":    state.Codecs,
+		"producers": state.Producers,
+		"consumers": state.Consumers,
+		"online":    state.Producers > 0,
+	}, nil
+}
+
+// snapshot 抓取当前画面
+func (c *CommandProcessor) snapshot(handler *Go2RTCProtocolHandler, name string) (interface{}, error) {
+	image, contentType, err := handler.Snapshot(name)
+	if err != nil {
+		if errors.Is(err, ErrStreamNotFound) {
+			return nil, platform.NewCommandError(platform.CommandErrNotFound, err, "流不存在")
+		}
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, err, "抓图失败")
+	}
+	if len(image) > maxSnapshotBytes {
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, nil,
+			"图片过大: %d 字节，上限 %d 字节", len(image), maxSnapshotBytes)
+	}
+	return map[string]interface{}{
+		"stream":       name,
+		"content_type": contentType,
+		"size":         len(image),
+		"image":        base64.StdEncoding.EncodeToString(image),
+	}, nil
+}
+
+// getStream 查询流并转换为指令错误
+func getStream(handler *Go2RTCProtocolHandler, name string) (*StreamState, error) {
+	state, err := handler.GetStream(name)
+	if err != nil {
+		if errors.Is(err, ErrStreamNotFound) {
+			return nil, platform.NewCommandError(platform.CommandErrNotFound, err, "流不存在")
+		}
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, err, "查询流失败")
+	}
+	return state, nil
+}
+
+// streamSources 获取流当前的源地址
+func streamSources(handler *Go2RTCProtocolHandler, name string) ([]string, error) {
+	state, err := getStream(handler, name)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]string, 0, len(state.Sources))
+	for _, src := range state.Sources {
+		if src != "" {
+			sources = append(sources, src)
+		}
+	}
+	return sources, nil
+}
+
+// commandParams 指令参数可能是JSON对象，也可能是JSON字符串
+func commandParams(raw interface{}) (map[string]interface{}, error) {
+	switch v := raw.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return map[string]interface{}{}, nil
+		}
+		params := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(v), &params); err != nil {
+			return nil, err
+		}
+		return params, nil
+	default:
+		return nil, fmt.Errorf("unexpected params type %T", raw)
+	}
+}
+
+// stringParam 按候选键名读取字符串参数
+func stringParam(params map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := params[key].(string); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
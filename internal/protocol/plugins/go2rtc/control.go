@@ -0,0 +1,653 @@
+// internal/protocol/plugins/go2rtc/control.go
+package go2rtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 看板可下发的控制项
+const (
+	ControlEnabled          = "enabled"           // false 时从go2rtc移除流，true 时恢复
+	ControlRecording        = "recording"         // 是否录像
+	ControlSnapshotInterval = "snapshot_interval" // 定时抓图间隔(秒)，0为关闭
+	ControlPrivacyMode      = "privacy_mode"      // true 时以占位画面替换真实源
+)
+
+// 平台属性设置可下发的配置项
+const (
+	AttributePreferredCodec   = "preferred_codec" // 期望的视频编码，h264/h265，为空时不转码
+	AttributeSubstreamURL     = "substream_url"   // 子码流地址，在go2rtc中注册为 {流名称}_sub
+	AttributeSnapshotInterval = ControlSnapshotInterval
+)
+
+var (
+	controlKeys = map[string]bool{
+		ControlEnabled:          true,
+		ControlRecording:        true,
+		ControlSnapshotInterval: true,
+		ControlPrivacyMode:      true,
+	}
+	attributeKeys = map[string]bool{
+		AttributePreferredCodec:   true,
+		AttributeSubstreamURL:     true,
+		AttributeSnapshotInterval: true,
+	}
+	// 支持转码的视频编码
+	supportedCodecs = map[string]bool{"h264": true, "h265": true}
+)
+
+// 子码流在go2rtc中的流名称后缀
+const substreamSuffix = "_sub"
+
+// 控制默认值
+const (
+	// go2rtc 内置的纯色测试画面
+	defaultPlaceholderSource   = "ffmpeg:virtual?video=color&size=720#video=h264"
+	defaultRecordingSegment    = 10 * time.Minute
+	minSnapshotIntervalSeconds = 5
+)
+
+// ControlConfig 流控制配置
+type ControlConfig struct {
+	StateFile         string        // 控制状态文件，为空时仅保存在内存
+	PlaceholderSource string        // 隐私模式下替换的源地址
+	RecordingDir      string        // 录像目录
+	RecordingSegment  time.Duration // 单个录像文件时长
+	SnapshotDir       string        // 定时抓图目录
+}
+
+// StreamControl 单个流的控制状态
+type StreamControl struct {
+	AccessPointID    string    `json:"access_point_id"`
+	Stream           string    `json:"stream"`
+	DeviceID         string    `json:"device_id"`
+	Enabled          bool      `json:"enabled"`
+	Recording        bool      `json:"recording"`
+	SnapshotInterval int       `json:"snapshot_interval"`
+	PrivacyMode      bool      `json:"privacy_mode"`
+	PreferredCodec   string    `json:"preferred_codec,omitempty"`
+	SubstreamURL     string    `json:"substream_url,omitempty"`
+	Sources          []string  `json:"sources,omitempty"` // 禁用或隐私模式前的源地址，恢复时使用
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// overridden 源地址是否已被替换或流已被移除
+func (c *StreamControl) overridden() bool {
+	return !c.Enabled || c.PrivacyMode
+}
+
+// isDefault 是否与未设置过的流相同
+func (c *StreamControl) isDefault() bool {
+	return c.Enabled && !c.Recording && c.SnapshotInterval == 0 && !c.PrivacyMode &&
+		c.PreferredCodec == "" && c.SubstreamURL == ""
+}
+
+// substreamSource 子码流应在go2rtc中使用的源地址，主流被禁用或处于隐私模式时为空
+func (c *StreamControl) substreamSource() string {
+	if c.overridden() {
+		return ""
+	}
+	return c.SubstreamURL
+}
+
+// set 按设置项更新控制状态
+func (c *StreamControl) set(key string, raw interface{}) error {
+	var err error
+	switch key {
+	case ControlEnabled:
+		c.Enabled, err = boolValue(raw)
+	case ControlRecording:
+		c.Recording, err = boolValue(raw)
+	case ControlPrivacyMode:
+		c.PrivacyMode, err = boolValue(raw)
+	case ControlSnapshotInterval:
+		var v int
+		if v, err = intValue(raw); err != nil {
+			return err
+		}
+		if v < 0 {
+			v = 0
+		}
+		if v > 0 && v < minSnapshotIntervalSeconds {
+			v = minSnapshotIntervalSeconds
+		}
+		c.SnapshotInterval = v
+	case AttributePreferredCodec:
+		v, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("无效的编码: %v", raw)
+		}
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "auto" || v == "none" {
+			v = ""
+		}
+		if v != "" && !supportedCodecs[v] {
+			return fmt.Errorf("不支持的编码: %s", v)
+		}
+		c.PreferredCodec = v
+	case AttributeSubstreamURL:
+		v, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("无效的地址: %v", raw)
+		}
+		v = strings.TrimSpace(v)
+		if v != "" {
+			if u, perr := url.Parse(v); perr != nil || u.Scheme == "" {
+				return fmt.Errorf("无效的地址: %s", redactURL(v))
+			}
+		}
+		c.SubstreamURL = v
+	default:
+		return fmt.Errorf("未识别的设置项: %s", key)
+	}
+	return err
+}
+
+// value 设置项当前的值
+func (c *StreamControl) value(key string) interface{} {
+	switch key {
+	case ControlEnabled:
+		return c.Enabled
+	case ControlRecording:
+		return c.Recording
+	case ControlPrivacyMode:
+		return c.PrivacyMode
+	case ControlSnapshotInterval:
+		return c.SnapshotInterval
+	case AttributePreferredCodec:
+		return c.PreferredCodec
+	case AttributeSubstreamURL:
+		return redactURL(c.SubstreamURL)
+	}
+	return nil
+}
+
+// ControlStore 流控制状态，持久化保证重启后禁用、隐私、录像等设置仍然生效
+type ControlStore struct {
+	cfg    ControlConfig
+	logger *logrus.Logger
+
+	mu      sync.Mutex
+	entries map[string]*StreamControl // 接入点ID/流名称 -> 控制状态
+}
+
+// NewControlStore 创建流控制状态并加载已有记录
+func NewControlStore(cfg ControlConfig, logger *logrus.Logger) (*ControlStore, error) {
+	if cfg.PlaceholderSource == "" {
+		cfg.PlaceholderSource = defaultPlaceholderSource
+	}
+	if cfg.RecordingSegment <= 0 {
+		cfg.RecordingSegment = defaultRecordingSegment
+	}
+
+	s := &ControlStore{
+		cfg:     cfg,
+		logger:  logger,
+		entries: make(map[string]*StreamControl),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func controlKey(accessPointID, stream string) string {
+	return accessPointID + "/" + stream
+}
+
+// Get 获取流的控制状态，未设置过的流返回默认状态(启用)
+func (s *ControlStore) Get(accessPointID, stream string) StreamControl {
+	if s == nil {
+		return StreamControl{AccessPointID: accessPointID, Stream: stream, Enabled: true}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[controlKey(accessPointID, stream)]; ok {
+		c := *entry
+		c.Sources = append([]string(nil), entry.Sources...)
+		return c
+	}
+	return StreamControl{AccessPointID: accessPointID, Stream: stream, Enabled: true}
+}
+
+// Has 流是否有控制记录
+func (s *ControlStore) Has(accessPointID, stream string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.entries[controlKey(accessPointID, stream)]
+	return ok
+}
+
+// Disabled 流是否已被禁用，禁用的流不在go2rtc中，但同步时不按下线处理
+func (s *ControlStore) Disabled(accessPointID, stream string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[controlKey(accessPointID, stream)]
+	return ok && !entry.Enabled
+}
+
+// Substream 流是否为某个流的子码流，子码流不作为独立设备同步
+func (s *ControlStore) Substream(accessPointID, stream string) bool {
+	if s == nil || !strings.HasSuffix(stream, substreamSuffix) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[controlKey(accessPointID, strings.TrimSuffix(stream, substreamSuffix))]
+	return ok && entry.SubstreamURL != ""
+}
+
+// List 全部控制记录
+func (s *ControlStore) List() []StreamControl {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]StreamControl, 0, len(s.entries))
+	for _, entry := range s.entries {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AccessPointID != result[j].AccessPointID {
+			return result[i].AccessPointID < result[j].AccessPointID
+		}
+		return result[i].Stream < result[j].Stream
+	})
+	return result
+}
+
+// put 保存控制状态，恢复为默认状态时删除记录
+func (s *ControlStore) put(c StreamControl) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := controlKey(c.AccessPointID, c.Stream)
+	if c.isDefault() {
+		delete(s.entries, key)
+	} else {
+		c.UpdatedAt = time.Now()
+		s.entries[key] = &c
+	}
+	s.saveLocked()
+}
+
+// remove 删除控制记录
+func (s *ControlStore) remove(accessPointID, stream string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, controlKey(accessPointID, stream))
+	s.saveLocked()
+}
+
+// load 加载持久化的控制状态
+func (s *ControlStore) load() error {
+	if s.cfg.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.cfg.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取流控制状态文件失败: %v", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return fmt.Errorf("解析流控制状态文件失败: %v", err)
+	}
+	return nil
+}
+
+// saveLocked 持久化控制状态，调用方需持有锁
+func (s *ControlStore) saveLocked() {
+	if s.cfg.StateFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		s.logger.WithError(err).Error("序列化流控制状态失败")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.cfg.StateFile), 0755); err != nil {
+		s.logger.WithError(err).Error("创建流控制状态目录失败")
+		return
+	}
+
+	tmp := s.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		s.logger.WithError(err).Error("写入流控制状态文件失败")
+		return
+	}
+	if err := os.Rename(tmp, s.cfg.StateFile); err != nil {
+		s.logger.WithError(err).Error("写入流控制状态文件失败")
+	}
+}
+
+// ControlProcessor go2rtc设备控制处理器
+// 处理看板下发的遥测控制，转换为go2rtc操作后将实际生效的值作为遥测上报
+type ControlProcessor struct {
+	manager        *SyncManager
+	store          *ControlStore
+	platformClient platform.Client
+	logger         *logrus.Logger
+
+	mu      sync.Mutex
+	workers map[string]*streamWorkers // 接入点ID/流名称 -> 录像与抓图任务
+}
+
+// NewControlProcessor 创建控制处理器
+func NewControlProcessor(manager *SyncManager, store *ControlStore, platformClient platform.Client, logger *logrus.Logger) *ControlProcessor {
+	return &ControlProcessor{
+		manager:        manager,
+		store:          store,
+		platformClient: platformClient,
+		logger:         logger,
+		workers:        make(map[string]*streamWorkers),
+	}
+}
+
+// Start 按持久化的控制状态恢复录像与定时抓图
+func (c *ControlProcessor) Start() {
+	for _, ctrl := range c.store.List() {
+		if _, ok := c.manager.GetService(ctrl.AccessPointID); !ok {
+			c.logger.Warnf("接入点未启用同步，跳过恢复流控制: %s/%s", ctrl.AccessPointID, ctrl.Stream)
+			continue
+		}
+		c.applyWorkers(ctrl)
+	}
+}
+
+// Stop 停止全部录像与定时抓图
+func (c *ControlProcessor) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, w := range c.workers {
+		w.stop()
+		delete(c.workers, key)
+	}
+}
+
+// ProcessControl 处理控制消息，未识别的控制项忽略
+func (c *ControlProcessor) ProcessControl(deviceID string, controlData map[string]interface{}) error {
+	applied, err := c.update(deviceID, controlData, controlKeys)
+	if err != nil || len(applied) == 0 {
+		return err
+	}
+	// 上报实际生效的值
+	if err := c.platformClient.SendTelemetry(deviceID, applied); err != nil {
+		c.logger.WithError(err).WithField("device_id", deviceID).Warn("上报控制结果失败")
+	}
+	return nil
+}
+
+// ProcessAttributeSet 处理平台下发的属性设置，生效后将实际值作为属性上报
+func (c *ControlProcessor) ProcessAttributeSet(deviceID, messageID string, values map[string]interface{}) (map[string]interface{}, error) {
+	applied, err := c.update(deviceID, values, attributeKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return nil, platform.NewCommandError(platform.CommandErrUnsupported, nil, "没有可设置的属性")
+	}
+	if err := c.platformClient.SendAttributes(deviceID, applied); err != nil {
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"device_id":  deviceID,
+			"message_id": messageID,
+		}).Warn("上报属性设置结果失败")
+	}
+	return applied, nil
+}
+
+// update 解析并应用允许的设置项，返回实际生效的值
+func (c *ControlProcessor) update(deviceID string, values map[string]interface{}, allowed map[string]bool) (map[string]interface{}, error) {
+	service, name, err := c.manager.ResolveDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, ErrStreamNotFound) || errors.Is(err, platform.ErrNotFound) {
+			return nil, platform.NewCommandError(platform.CommandErrNotFound, err, "设备对应的流不存在")
+		}
+		return nil, platform.NewCommandError(platform.CommandErrInternal, err, "查找设备对应的流失败")
+	}
+
+	prev := c.store.Get(service.AccessPointID(), name)
+	next := prev
+	next.DeviceID = deviceID
+
+	applied := make(map[string]interface{})
+	for key, raw := range values {
+		if !allowed[key] {
+			c.logger.Debugf("忽略未识别的设置项: %s", key)
+			continue
+		}
+		if err := next.set(key, raw); err != nil {
+			return nil, platform.NewCommandError(platform.CommandErrInvalidParams, err, "%s 的值无效", key)
+		}
+		applied[key] = nil
+	}
+	if len(applied) == 0 {
+		return applied, nil
+	}
+
+	if err := c.applySources(service.handler, &prev, &next); err != nil {
+		return nil, platform.NewCommandError(platform.CommandErrUpstream, err, "调整go2rtc流失败")
+	}
+	c.store.put(next)
+	c.applyWorkers(next)
+
+	for key := range applied {
+		applied[key] = next.value(key)
+	}
+	c.logger.WithFields(logrus.Fields{
+		"device_id":    deviceID,
+		"stream":       name,
+		"access_point": service.AccessPointID(),
+		"applied":      applied,
+	}).Info("流设置已生效")
+	return applied, nil
+}
+
+// applySources 按控制状态调整go2rtc中的流与子码流
+// 首次替换或移除前保存原始源地址，恢复时写回
+func (c *ControlProcessor) applySources(handler *Go2RTCProtocolHandler, prev, next *StreamControl) error {
+	name := next.Stream
+	if !prev.overridden() && next.overridden() {
+		state, err := handler.GetStream(name)
+		if err != nil {
+			return fmt.Errorf("获取流源地址失败: %w", err)
+		}
+		next.Sources = append([]string(nil), state.Sources...)
+	}
+
+	switch {
+	case !next.Enabled:
+		if prev.Enabled {
+			if err := handler.RemoveStream(name); err != nil {
+				return fmt.Errorf("移除流失败: %w", err)
+			}
+		}
+	case next.PrivacyMode:
+		if !prev.Enabled || !prev.PrivacyMode {
+			if err := handler.SetStreamSources(name, []string{c.store.cfg.PlaceholderSource}); err != nil {
+				return fmt.Errorf("切换占位画面失败: %w", err)
+			}
+		}
+	case prev.overridden():
+		if len(next.Sources) == 0 {
+			return fmt.Errorf("没有保存的源地址，无法恢复流: %s", name)
+		}
+		if err := handler.SetStreamSources(name, next.Sources); err != nil {
+			return fmt.Errorf("恢复流失败: %w", err)
+		}
+		next.Sources = nil
+	}
+
+	if prev.PreferredCodec != next.PreferredCodec {
+		if next.overridden() {
+			// 流恢复时写回的源地址中带上转码源
+			next.Sources = withTranscode(next.Sources, name, next.PreferredCodec)
+		} else {
+			state, err := handler.GetStream(name)
+			if err != nil {
+				return fmt.Errorf("获取流源地址失败: %w", err)
+			}
+			if err := handler.SetStreamSources(name, withTranscode(state.Sources, name, next.PreferredCodec)); err != nil {
+				return fmt.Errorf("设置转码失败: %w", err)
+			}
+		}
+	}
+
+	if prevSub, nextSub := prev.substreamSource(), next.substreamSource(); prevSub != nextSub {
+		sub := name + substreamSuffix
+		if nextSub == "" {
+			if err := handler.RemoveStream(sub); err != nil {
+				return fmt.Errorf("移除子码流失败: %w", err)
+			}
+		} else if err := handler.SetStreamSources(sub, []string{nextSub}); err != nil {
+			return fmt.Errorf("设置子码流失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// withTranscode 替换流的转码源，codec 为空时只移除
+// go2rtc 在客户端不支持原始编码时从 ffmpeg:{流名称}#video={编码} 取转码后的画面
+func withTranscode(sources []string, name, codec string) []string {
+	prefix := "ffmpeg:" + name + "#video="
+	result := make([]string, 0, len(sources)+1)
+	for _, src := range sources {
+		if src != "" && !strings.HasPrefix(src, prefix) {
+			result = append(result, src)
+		}
+	}
+	if codec != "" {
+		result = append(result, prefix+codec)
+	}
+	return result
+}
+
+// applyWorkers 按控制状态启停录像与定时抓图
+// 流被禁用或处于隐私模式时暂停
+func (c *ControlProcessor) applyWorkers(ctrl StreamControl) {
+	key := controlKey(ctrl.AccessPointID, ctrl.Stream)
+	recording := ctrl.Recording && !ctrl.overridden()
+	interval := time.Duration(ctrl.SnapshotInterval) * time.Second
+	if ctrl.overridden() {
+		interval = 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w, ok := c.workers[key]
+	if !ok {
+		if !recording && interval == 0 {
+			return
+		}
+		w = newStreamWorkers(c.handlerFor(ctrl.AccessPointID), ctrl.Stream, c.store.cfg, c.logger.WithFields(logrus.Fields{
+			"access_point": ctrl.AccessPointID,
+			"stream":       ctrl.Stream,
+		}))
+		c.workers[key] = w
+	}
+
+	w.setRecording(recording)
+	w.setSnapshotInterval(interval)
+	if !recording && interval == 0 {
+		w.stop()
+		delete(c.workers, key)
+	}
+}
+
+// handlerFor 返回获取接入点当前go2rtc客户端的函数
+// 接入点配置修改后同步服务会重建，录像与抓图每次执行时重新获取，使用新的地址和认证
+func (c *ControlProcessor) handlerFor(accessPointID string) func() (*Go2RTCProtocolHandler, error) {
+	return func() (*Go2RTCProtocolHandler, error) {
+		service, ok := c.manager.GetService(accessPointID)
+		if !ok {
+			return nil, fmt.Errorf("接入点未启用同步: %s", accessPointID)
+		}
+		return service.handler, nil
+	}
+}
+
+// release 停止录像与定时抓图，返回是否有运行中的任务
+// 只停止内存中的任务，不修改控制记录：平台修改设备配置时也会发送断开通知，重启后应按记录恢复
+func (c *ControlProcessor) release(accessPointID, stream string) bool {
+	key := controlKey(accessPointID, stream)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, running := c.workers[key]
+	if running {
+		w.stop()
+		delete(c.workers, key)
+	}
+	return running
+}
+
+// forget 设备确认已从平台删除后修改控制记录
+// dropRecord 为true时删除控制记录(流已从go2rtc移除)，否则只关闭录像与抓图设置，避免重启后恢复
+func (c *ControlProcessor) forget(accessPointID, stream string, dropRecord bool) {
+	if !c.store.Has(accessPointID, stream) {
+		return
+	}
+	if dropRecord {
+		c.store.remove(accessPointID, stream)
+		return
+	}
+	ctrl := c.store.Get(accessPointID, stream)
+	ctrl.Recording = false
+	ctrl.SnapshotInterval = 0
+	c.store.put(ctrl)
+}
+
+// boolValue 控制值可能是布尔、数字或字符串
+func boolValue(raw interface{}) (bool, error) {
+	switch v := raw.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("无效的布尔值: %q", v)
+		}
+		return b, nil
+	}
+	return false, fmt.Errorf("无效的布尔值: %v", raw)
+}
+
+// intValue 控制值可能是数字或字符串
+func intValue(raw interface{}) (int, error) {
+	switch v := raw.(type) {
+	case float64:
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("无效的整数: %q", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("无效的整数: %v", raw)
+}
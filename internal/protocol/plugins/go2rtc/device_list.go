@@ -0,0 +1,95 @@
+// internal/protocol/plugins/go2rtc/device_list.go
+package go2rtc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 设备列表默认每页数量
+const defaultDeviceListPageSize = 10
+
+// 生产者状态
+const (
+	producerActive  = "在线"  // 已连接源
+	producerIdle    = "待连接" // 已配置源，go2rtc在有观看者时才连接
+	producerMissing = "无源"
+)
+
+// StreamListItem 设备列表中的一个流
+type StreamListItem struct {
+	StreamState
+	Description string
+}
+
+// PageStreams 按关键字筛选后按流名称排序分页，返回当前页和筛选后的总数
+// 关键字不区分大小写，匹配流名称和描述(源类型、主机、编码)；page 从1开始
+func PageStreams(streams []StreamState, keyword string, page, pageSize int) ([]StreamListItem, int) {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	items := make([]StreamListItem, 0, len(streams))
+	for _, stream := range streams {
+		item := StreamListItem{StreamState: stream, Description: DescribeStream(stream)}
+		if keyword != "" &&
+			!strings.Contains(strings.ToLower(stream.Name), keyword) &&
+			!strings.Contains(strings.ToLower(item.Description), keyword) {
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultDeviceListPageSize
+	}
+	total := len(items)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []StreamListItem{}, total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return items[start:end], total
+}
+
+// DescribeStream 设备列表中的流描述，如 "RTSP | 10.0.0.2:554 | H264,PCMA | 在线 | 观看 2"
+// 主机不含用户名和密码，无法按URL解析的源(如转码源)不显示主机
+func DescribeStream(stream StreamState) string {
+	parts := make([]string, 0, 5)
+
+	scheme, u := parseSource(stream.URL)
+	if scheme == "" {
+		scheme = "unknown"
+	}
+	parts = append(parts, strings.ToUpper(scheme))
+	if u != nil && u.Host != "" {
+		parts = append(parts, u.Host)
+	}
+
+	if len(stream.Codecs) > 0 {
+		parts = append(parts, strings.Join(stream.Codecs, ","))
+	} else {
+		parts = append(parts, "编码未知")
+	}
+	parts = append(parts, producerState(stream), fmt.Sprintf("观看 %d", stream.Consumers))
+	return strings.Join(parts, " | ")
+}
+
+// producerState 流的生产者状态
+func producerState(stream StreamState) string {
+	switch {
+	case stream.ActiveProducers > 0:
+		return producerActive
+	case stream.Producers > 0:
+		return producerIdle
+	default:
+		return producerMissing
+	}
+}
@@ -0,0 +1,181 @@
+// internal/protocol/plugins/go2rtc/dryrun.go
+package go2rtc
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// 预览报告中的操作类型
+const (
+	DiffActionRegister = "register" // 注册新设备
+	DiffActionUpdate   = "update"   // 平台已有设备，刷新在线状态和属性
+	DiffActionOffline  = "offline"  // 置为离线
+	DiffActionRemove   = "remove"   // 标记为已停用(插件API不支持删除设备)
+)
+
+// FilteredStream 被过滤规则排除的流
+type FilteredStream struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// DiffEntry 预览报告中的单个设备操作
+type DiffEntry struct {
+	Action       string                 `json:"action"`
+	DeviceNumber string                 `json:"device_number"`
+	DeviceName   string                 `json:"device_name,omitempty"`
+	StreamURL    string                 `json:"stream_url,omitempty"` // 已隐藏密码
+	Reason       string                 `json:"reason,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// SyncReport 同步预览报告
+type SyncReport struct {
+	AccessPointID string           `json:"access_point_id"`
+	Go2RTCURL     string           `json:"go2rtc_url"`
+	GeneratedAt   time.Time        `json:"generated_at"`
+	OffboardMode  OffboardPolicy   `json:"offboard_policy"`
+	Register      []DiffEntry      `json:"register"`
+	Update        []DiffEntry      `json:"update"`
+	Offline       []DiffEntry      `json:"offline"`
+	Remove        []DiffEntry      `json:"remove"`
+	Filtered      []FilteredStream `json:"filtered"`
+	Deferred      []string         `json:"deferred"`  // 在死信列表等待期内，本轮不会重试
+	Unchanged     []string         `json:"unchanged"` // 已同步且无需操作
+}
+
+// DryRun 执行一轮不产生副作用的同步，返回将执行的操作
+// 只读取go2rtc流列表和平台设备信息，不注册设备、不发送MQTT消息
+func (s *DeviceSyncService) DryRun() (*SyncReport, error) {
+	streams, err := s.handler.ListStreams()
+	if err != nil {
+		return nil, fmt.Errorf("获取go2rtc streams失败: %v", err)
+	}
+
+	policy := OffboardKeepOffline
+	if s.offboarder != nil {
+		policy = s.offboarder.Policy()
+	}
+
+	report := &SyncReport{
+		AccessPointID: s.accessPointID,
+		Go2RTCURL:     s.handler.APIURL(),
+		GeneratedAt:   time.Now(),
+		OffboardMode:  policy,
+		Register:      []DiffEntry{},
+		Update:        []DiffEntry{},
+		Offline:       []DiffEntry{},
+		Remove:        []DiffEntry{},
+		Filtered:      []FilteredStream{},
+		Deferred:      []string{},
+		Unchanged:     []string{},
+	}
+
+	p := s.plan(streams, report.GeneratedAt)
+	report.Filtered = append(report.Filtered, p.filtered...)
+	for _, stream := range p.deferred {
+		report.Deferred = append(report.Deferred, stream.Name)
+	}
+	for _, stream := range p.synced {
+		report.Unchanged = append(report.Unchanged, stream.Name)
+	}
+
+	for _, stream := range p.register {
+		entry := s.previewRegister(stream)
+		if entry.Action == DiffActionUpdate {
+			report.Update = append(report.Update, entry)
+		} else {
+			report.Register = append(report.Register, entry)
+		}
+	}
+
+	for _, item := range p.offboard {
+		entry := DiffEntry{
+			Action:       DiffActionOffline,
+			DeviceNumber: item.name,
+			Reason:       item.reason,
+		}
+		report.Offline = append(report.Offline, entry)
+	}
+
+	// 到期待停用的设备
+	if s.offboarder != nil {
+		for _, number := range s.offboarder.Due(s.accessPointID) {
+			report.Remove = append(report.Remove, DiffEntry{
+				Action:       DiffActionRemove,
+				DeviceNumber: number,
+				Reason:       "decommission",
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// previewRegister 预览单个设备的注册操作
+func (s *DeviceSyncService) previewRegister(stream StreamInfo) DiffEntry {
+	entry := DiffEntry{
+		Action:       DiffActionRegister,
+		DeviceNumber: stream.Name,
+		StreamURL:    redactURL(stream.URL),
+	}
+
+	if s.namer != nil {
+		meta, err := s.namer.Render(stream)
+		if err != nil {
+			entry.Reason = err.Error()
+		} else {
+			entry.DeviceName = meta.Name
+			if len(meta.Attributes) > 0 {
+				entry.Attributes = meta.Attributes
+			}
+		}
+	}
+
+	// 平台已有同编号设备时，同步只会刷新状态和属性
+	if device, err := s.platformClient.GetDevice(stream.Name); err == nil && device != nil {
+		entry.Action = DiffActionUpdate
+		entry.Reason = "平台已存在设备"
+	}
+	return entry
+}
+
+// DryRun 预览指定接入点的同步
+// 接入点未启用自动同步时按其凭证临时创建同步服务(不启动)
+func (m *SyncManager) DryRun(accessPointID string) (*SyncReport, error) {
+	if service, ok := m.GetService(accessPointID); ok {
+		return service.DryRun()
+	}
+
+	accessPoints, err := m.platformClient.GetServiceAccessPoints()
+	if err != nil {
+		return nil, err
+	}
+	for _, ap := range accessPoints {
+		if ap.ID != accessPointID {
+			continue
+		}
+		voucher, err := ParseAccessPointVoucher(ap.Voucher)
+		if err != nil {
+			return nil, err
+		}
+		service, err := m.newSyncService(ap.ID, voucher)
+		if err != nil {
+			return nil, err
+		}
+		defer service.Stop()
+		return service.DryRun()
+	}
+	return nil, fmt.Errorf("接入点不存在: %s", accessPointID)
+}
+
+// credentialPattern 匹配地址中的 scheme://user:pass@ 部分
+// go2rtc的源地址可能是 ffmpeg:rtsp://... 或 exec:ffmpeg -i rtsp://... 这类不透明地址，需按内嵌的每个地址处理
+var credentialPattern = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.-]*://[^/@\s:]*):[^/@\s]*@`)
+
+// redactURL 隐藏地址中的密码，格式与 url.URL.Redacted 一致
+func redactURL(raw string) string {
+	return credentialPattern.ReplaceAllString(raw, "${1}:xxxxx@")
+}
@@ -0,0 +1,28 @@
+// internal/protocol/plugins/go2rtc/events.go
+package go2rtc
+
+import (
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 设备事件标识符，需在平台物模型中定义同名事件
+const (
+	EventStreamStarted        = "stream_started"        // 流已注册并上线
+	EventStreamLost           = "stream_lost"           // 流已从go2rtc移除或被过滤规则排除
+	EventDeviceDecommissioned = "device_decommissioned" // 设备已停用
+)
+
+// emitEvent 发送设备事件，失败只记录日志
+func emitEvent(pc platform.Client, logger logrus.FieldLogger, deviceID, method string, params map[string]interface{}) {
+	if pc == nil || deviceID == "" {
+		return
+	}
+	if err := pc.SendEvent(deviceID, method, params); err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"device_id": deviceID,
+			"event":     method,
+		}).Warn("发送设备事件失败")
+	}
+}
@@ -0,0 +1,158 @@
+// internal/protocol/plugins/go2rtc/filter.go
+package go2rtc
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix 以该前缀开头的规则按正则表达式匹配，否则按glob匹配
+const regexPrefix = "re:"
+
+// StreamFilterConfig 流过滤规则配置
+type StreamFilterConfig struct {
+	Include     []string // 包含规则，为空表示全部包含
+	Exclude     []string // 排除规则，优先于包含规则
+	Marker      string   // 标记约定: 设置后只同步名称以该标记开头的流
+	SkipAliases bool     // 跳过引用其他流的转码别名(如 ffmpeg:camera1#video=h264)
+}
+
+// streamPattern 单条匹配规则
+type streamPattern struct {
+	raw   string
+	re    *regexp.Regexp
+	glob  string
+	isReg bool
+}
+
+func (p streamPattern) match(name string) bool {
+	if p.isReg {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// StreamFilter 决定哪些go2rtc流会注册为ThingsPanel设备
+type StreamFilter struct {
+	include     []streamPattern
+	exclude     []streamPattern
+	marker      string
+	skipAliases bool
+}
+
+// NewStreamFilter 编译过滤规则
+func NewStreamFilter(cfg StreamFilterConfig) (*StreamFilter, error) {
+	include, err := compilePatterns(cfg.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamFilter{
+		include:     include,
+		exclude:     exclude,
+		marker:      strings.TrimSpace(cfg.Marker),
+		skipAliases: cfg.SkipAliases,
+	}, nil
+}
+
+// compilePatterns 编译规则列表，忽略空规则
+func compilePatterns(rules []string) ([]streamPattern, error) {
+	patterns := make([]streamPattern, 0, len(rules))
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		if strings.HasPrefix(rule, regexPrefix) {
+			re, err := regexp.Compile(strings.TrimPrefix(rule, regexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("无效的正则规则 %q: %v", rule, err)
+			}
+			patterns = append(patterns, streamPattern{raw: rule, re: re, isReg: true})
+			continue
+		}
+
+		if _, err := path.Match(rule, ""); err != nil {
+			return nil, fmt.Errorf("无效的通配符规则 %q: %v", rule, err)
+		}
+		patterns = append(patterns, streamPattern{raw: rule, glob: rule})
+	}
+	return patterns, nil
+}
+
+// SplitPatterns 拆分表单中以逗号或换行分隔的规则
+func SplitPatterns(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+
+	rules := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			rules = append(rules, f)
+		}
+	}
+	return rules
+}
+
+// Match 判断流是否应注册为设备，不通过时返回原因
+// streams 为go2rtc当前全部流名称，用于识别转码别名
+func (f *StreamFilter) Match(stream StreamInfo, streams map[string]bool) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+
+	if f.marker != "" && !strings.HasPrefix(stream.Name, f.marker) {
+		return false, fmt.Sprintf("名称不含标记 %q", f.marker)
+	}
+
+	for _, p := range f.exclude {
+		if p.match(stream.Name) {
+			return false, fmt.Sprintf("命中排除规则 %q", p.raw)
+		}
+	}
+
+	if len(f.include) > 0 {
+		included := false
+		for _, p := range f.include {
+			if p.match(stream.Name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, "未命中任何包含规则"
+		}
+	}
+
+	if f.skipAliases {
+		if target, ok := aliasTarget(stream.URL); ok && streams[target] {
+			return false, fmt.Sprintf("转码别名，引用流 %q", target)
+		}
+	}
+
+	return true, ""
+}
+
+// aliasTarget 解析 ffmpeg:{stream}#... 形式的别名源，返回被引用的流名称
+func aliasTarget(source string) (string, bool) {
+	if !strings.HasPrefix(source, "ffmpeg:") {
+		return "", false
+	}
+	target := strings.TrimPrefix(source, "ffmpeg:")
+	if i := strings.IndexByte(target, '#'); i >= 0 {
+		target = target[:i]
+	}
+	if target == "" || strings.Contains(target, "://") {
+		return "", false
+	}
+	return target, true
+}
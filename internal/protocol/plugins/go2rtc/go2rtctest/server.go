@@ -0,0 +1,274 @@
+// internal/protocol/plugins/go2rtc/go2rtctest/server.go
+
+// Package go2rtctest 提供基于 httptest 的 go2rtc API 模拟服务，用于离线测试
+package go2rtctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 抓图返回的默认内容，JPEG文件头
+var defaultSnapshot = []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0xff, 0xd9}
+
+// Request 收到的一次API请求
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+}
+
+// Server 模拟 go2rtc 的 streams、抓图和 MP4 接口
+// 流保存在内存中，每个源地址对应一个已连接的生产者
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	streams  map[string][]string // 流名称 -> 源地址
+	codec    string              // 生产者 media 描述中的编码
+	snapshot []byte
+	hold     chan struct{} // 非nil时抓图请求等待其关闭后才返回
+	status   int           // 非0时全部请求返回该状态码
+	username string
+	password string
+	requests []Request
+}
+
+// NewServer 启动模拟服务，测试结束时调用 Close
+func NewServer() *Server {
+	s := &Server{
+		streams:  make(map[string][]string),
+		codec:    "H264",
+		snapshot: defaultSnapshot,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/streams", s.handleStreams)
+	mux.HandleFunc("/api/frame.jpeg", s.handleSnapshot)
+	mux.HandleFunc("/api/stream.mp4", s.handleMP4)
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// AddStream 添加或替换流
+func (s *Server) AddStream(name string, sources ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams[name] = append([]string(nil), sources...)
+}
+
+// RemoveStream 删除流
+func (s *Server) RemoveStream(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, name)
+}
+
+// Sources 流当前的源地址
+func (s *Server) Sources(name string) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sources, ok := s.streams[name]
+	return append([]string(nil), sources...), ok
+}
+
+// StreamNames 全部流名称，按名称排序
+func (s *Server) StreamNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.streams))
+	for name := range s.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetSnapshot 设置抓图返回的内容
+func (s *Server) SetSnapshot(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = append([]byte(nil), data...)
+}
+
+// HoldSnapshots 抓图请求挂起，直到调用返回的函数，用于模拟耗时的抓图
+func (s *Server) HoldSnapshots() (release func()) {
+	hold := make(chan struct{})
+	s.mu.Lock()
+	s.hold = hold
+	s.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			if s.hold == hold {
+				s.hold = nil
+			}
+			s.mu.Unlock()
+			close(hold)
+		})
+	}
+}
+
+// Fail 全部请求返回指定状态码，0为恢复正常
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// RequireBasicAuth 要求Basic认证，用户名为空时不认证
+func (s *Server) RequireBasicAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// Requests 收到的全部请求
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// record 记录请求，按 RequireBasicAuth 校验认证、按 Fail 设置返回错误
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery})
+		status := s.status
+		username, password := s.username, s.password
+		s.mu.Unlock()
+
+		if username != "" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != username || pass != password {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type producer struct {
+	URL    string   `json:"url"`
+	Medias []string `json:"medias"`
+}
+
+type stream struct {
+	Producers []producer        `json:"producers"`
+	Consumers []json.RawMessage `json:"consumers"`
+}
+
+// detailLocked 流的API表示，调用方需持有锁
+func (s *Server) detailLocked(name string) stream {
+	detail := stream{Producers: []producer{}, Consumers: []json.RawMessage{}}
+	for _, src := range s.streams[name] {
+		detail.Producers = append(detail.Producers, producer{
+			URL:    src,
+			Medias: []string{"video, recvonly, " + s.codec},
+		})
+	}
+	return detail
+}
+
+func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if name := query.Get("src"); name != "" {
+			if _, ok := s.streams[name]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON(w, s.detailLocked(name))
+			return
+		}
+		all := make(map[string]stream, len(s.streams))
+		for name := range s.streams {
+			all[name] = s.detailLocked(name)
+		}
+		writeJSON(w, all)
+	case http.MethodPut:
+		sources := query["src"]
+		if len(sources) == 0 {
+			http.Error(w, "src is required", http.StatusBadRequest)
+			return
+		}
+		name := query.Get("name")
+		if name == "" {
+			name = sources[0]
+		}
+		s.streams[name] = append([]string(nil), sources...)
+	case http.MethodDelete:
+		delete(s.streams, query.Get("src"))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	_, ok := s.streams[r.URL.Query().Get("src")]
+	snapshot := s.snapshot
+	hold := s.hold
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(snapshot)
+}
+
+// handleMP4 持续输出数据直到客户端断开
+func (s *Server) handleMP4(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	_, ok := s.streams[r.URL.Query().Get("src")]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Write([]byte("mp4-fragment")); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
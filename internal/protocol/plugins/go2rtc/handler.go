@@ -1,12 +1,17 @@
 package go2rtc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 
+	formjson "tp-plugin/internal/form_json"
 	"tp-plugin/internal/protocol"
 
 	"github.com/sirupsen/logrus"
@@ -23,7 +28,7 @@ type Go2RTCProtocolHandler struct {
 func NewHandler(port int) *Go2RTCProtocolHandler {
 	return &Go2RTCProtocolHandler{
 		port:   port,
-		client: &http.Client{Timeout: 5 * time.Second},
+		client: &http.Client{Timeout: 5 * time.Second, Transport: apiTransport{next: http.DefaultTransport}},
 		logger: logrus.New(),            // Should be injected or replaced
 		apiURL: "http://localhost:1984", // Default, will be updated from service Access Point if available
 	}
@@ -34,6 +39,35 @@ func (h *Go2RTCProtocolHandler) SetAPIURL(url string) {
 	h.apiURL = url
 }
 
+// APIURL returns the current go2rtc API URL
+func (h *Go2RTCProtocolHandler) APIURL() string {
+	return h.apiURL
+}
+
+// AuthEnabled 是否设置了go2rtc API认证
+func (h *Go2RTCProtocolHandler) AuthEnabled() bool {
+	t, ok := h.client.Transport.(apiTransport)
+	return ok && t.username != ""
+}
+
+// WithVoucher 按接入点凭证创建新的处理器，使用凭证中的go2rtc地址和认证，未填写地址时沿用当前地址
+// 不修改当前处理器，正在进行的请求不受影响
+func (h *Go2RTCProtocolHandler) WithVoucher(voucher formjson.SVCRForm) *Go2RTCProtocolHandler {
+	next := &Go2RTCProtocolHandler{
+		port: h.port,
+		client: &http.Client{
+			Timeout:   h.client.Timeout,
+			Transport: apiTransport{next: http.DefaultTransport, username: voucher.Username, password: voucher.Password},
+		},
+		logger: h.logger,
+		apiURL: h.apiURL,
+	}
+	if voucher.APIURL != "" {
+		next.apiURL = voucher.APIURL
+	}
+	return next
+}
+
 // --- ProtocolHandler Interface Implementation ---
 
 func (h *Go2RTCProtocolHandler) Name() string {
@@ -96,7 +130,10 @@ func (h *Go2RTCProtocolHandler) AddStream(name string, url string) error {
 	// Correct API based on typical go2rtc usage:
 	// PUT /api/streams?src=rtsp://...&name=camera1
 
-	fullURL := fmt.Sprintf("%s/api/streams?src=%s&name=%s", h.apiURL, url, name)
+	query := neturl.Values{}
+	query.Set("src", url)
+	query.Set("name", name)
+	fullURL := fmt.Sprintf("%s/api/streams?%s", h.apiURL, query.Encode())
 	req, err := http.NewRequest(http.MethodPut, fullURL, nil)
 	if err != nil {
 		return err
@@ -118,10 +155,13 @@ func (h *Go2RTCProtocolHandler) AddStream(name string, url string) error {
 }
 
 // RemoveStream removes a stream
-// DELETE /api/streams?src={url}&name={name} or just name?
-// DELETE /api/streams?name={name}
+// DELETE /api/streams?src={name}
+// go2rtc reads the stream name from `src` on DELETE; `name` is kept for older builds.
 func (h *Go2RTCProtocolHandler) RemoveStream(name string) error {
-	fullURL := fmt.Sprintf("%s/api/streams?name=%s", h.apiURL, name)
+	query := neturl.Values{}
+	query.Set("src", name)
+	query.Set("name", name)
+	fullURL := fmt.Sprintf("%s/api/streams?%s", h.apiURL, query.Encode())
 	req, err := http.NewRequest(http.MethodDelete, fullURL, nil)
 	if err != nil {
 		return err
@@ -146,13 +186,45 @@ func (h *Go2RTCProtocolHandler) RemoveStream(name string) error {
 type StreamInfo struct {
 	Name    string   `json:"name"`
 	Sources []string `json:"sources,omitempty"`
-	URL     string   `json:"url,omitempty"` // 提取的第一个源地址
+	URL     string   `json:"url,omitempty"`    // 提取的第一个源地址
+	Codecs  []string `json:"codecs,omitempty"` // 生产者已协商的编码，如 H264、PCMA
 }
 
 type streamDetail struct {
 	Producers []struct {
-		URL string `json:"url"`
+		URL    string   `json:"url"`
+		Medias []string `json:"medias"` // 如 "video, recvonly, H264"
 	} `json:"producers"`
+	Consumers []json.RawMessage `json:"consumers"`
+}
+
+// ErrStreamNotFound go2rtc中不存在该流
+var ErrStreamNotFound = errors.New("stream not found")
+
+// 抓图需要等待关键帧，超时时间比普通API请求长
+const snapshotTimeout = 15 * time.Second
+
+// StreamState 单个流的运行状态
+type StreamState struct {
+	StreamInfo
+	Producers       int `json:"producers"`
+	ActiveProducers int `json:"active_producers"` // 已连接并协商出媒体的生产者，go2rtc按需连接源
+	Consumers       int `json:"consumers"`
+}
+
+// parseCodecs 从生产者media描述中提取去重后的编码列表
+func parseCodecs(medias []string, seen map[string]bool, codecs []string) []string {
+	for _, media := range medias {
+		parts := strings.Split(media, ",")
+		for i := 2; i < len(parts); i++ {
+			codec := strings.TrimSpace(parts[i])
+			if codec != "" && !seen[codec] {
+				seen[codec] = true
+				codecs = append(codecs, codec)
+			}
+		}
+	}
+	return codecs
 }
 
 // ... (existing code)
@@ -185,11 +257,7 @@ func (h *Go2RTCProtocolHandler) ListStreams() ([]StreamInfo, error) {
 
 	var streams []StreamInfo
 	for name, detail := range streamsMap {
-		info := StreamInfo{Name: name}
-		if len(detail.Producers) > 0 {
-			info.URL = detail.Producers[0].URL
-			info.Sources = append(info.Sources, info.URL)
-		}
+		info := detail.info(name)
 		// Debug log
 		h.logger.Infof("Parsed stream: %s, URL: %s, Producers: %d", name, info.URL, len(detail.Producers))
 		streams = append(streams, info)
@@ -198,3 +266,208 @@ func (h *Go2RTCProtocolHandler) ListStreams() ([]StreamInfo, error) {
 	h.logger.Debugf("Listed %d streams from go2rtc", len(streams))
 	return streams, nil
 }
+
+// Ping 检查go2rtc API是否可用，返回请求耗时
+// GET /api/streams，只检查状态码不解析内容
+func (h *Go2RTCProtocolHandler) Ping() (time.Duration, error) {
+	start := time.Now()
+	resp, err := h.client.Get(fmt.Sprintf("%s/api/streams", h.apiURL))
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach go2rtc: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	latency := time.Since(start)
+	if resp.StatusCode >= 400 {
+		return latency, fmt.Errorf("go2rtc API error: %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// info 提取流地址和编码
+func (d streamDetail) info(name string) StreamInfo {
+	info := StreamInfo{Name: name}
+	if len(d.Producers) > 0 {
+		info.URL = d.Producers[0].URL
+		info.Sources = append(info.Sources, info.URL)
+	}
+	seen := make(map[string]bool)
+	for _, producer := range d.Producers {
+		info.Codecs = parseCodecs(producer.Medias, seen, info.Codecs)
+	}
+	return info
+}
+
+// GetStream 查询单个流的源地址、编码及连接数
+// GET /api/streams?src={name}
+func (h *Go2RTCProtocolHandler) GetStream(name string) (*StreamState, error) {
+	query := neturl.Values{}
+	query.Set("src", name)
+	resp, err := h.client.Get(fmt.Sprintf("%s/api/streams?%s", h.apiURL, query.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query go2rtc stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrStreamNotFound, name)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("go2rtc API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	// 部分版本对不存在的流返回 null
+	if strings.TrimSpace(string(body)) == "null" {
+		return nil, fmt.Errorf("%w: %s", ErrStreamNotFound, name)
+	}
+	var detail streamDetail
+	if err := json.Unmarshal(body, &detail); err != nil {
+		return nil, fmt.Errorf("failed to parse stream: %v", err)
+	}
+
+	state := detail.state(name)
+	return &state, nil
+}
+
+// ListStreamStates 获取全部流的源地址、编码及连接数
+// GET /api/streams
+func (h *Go2RTCProtocolHandler) ListStreamStates() ([]StreamState, error) {
+	resp, err := h.client.Get(fmt.Sprintf("%s/api/streams", h.apiURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query go2rtc streams: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("go2rtc API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var streamsMap map[string]streamDetail
+	if err := json.Unmarshal(body, &streamsMap); err != nil {
+		return nil, fmt.Errorf("failed to parse streams: %v", err)
+	}
+	states := make([]StreamState, 0, len(streamsMap))
+	for name, detail := range streamsMap {
+		states = append(states, detail.state(name))
+	}
+	return states, nil
+}
+
+// state 流的运行状态，源地址以生产者为准，每个源对应一个生产者
+func (d streamDetail) state(name string) StreamState {
+	info := d.info(name)
+	info.Sources = info.Sources[:0]
+	active := 0
+	for _, producer := range d.Producers {
+		info.Sources = append(info.Sources, producer.URL)
+		if len(producer.Medias) > 0 {
+			active++
+		}
+	}
+	return StreamState{
+		StreamInfo:      info,
+		Producers:       len(d.Producers),
+		ActiveProducers: active,
+		Consumers:       len(d.Consumers),
+	}
+}
+
+// SetStreamSources 以给定的源地址重建流，已有的连接会断开重连
+// PUT /api/streams?src={url1}&src={url2}&name={name}
+func (h *Go2RTCProtocolHandler) SetStreamSources(name string, sources []string) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("stream %s has no sources", name)
+	}
+
+	query := neturl.Values{}
+	for _, src := range sources {
+		query.Add("src", src)
+	}
+	query.Set("name", name)
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/api/streams?%s", h.apiURL, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("go2rtc API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	h.logger.Infof("Updated stream '%s' sources: %d", name, len(sources))
+	return nil
+}
+
+// Snapshot 抓取流的当前画面(JPEG)
+// GET /api/frame.jpeg?src={name}
+func (h *Go2RTCProtocolHandler) Snapshot(name string) ([]byte, string, error) {
+	query := neturl.Values{}
+	query.Set("src", name)
+
+	client := &http.Client{Timeout: snapshotTimeout, Transport: h.client.Transport}
+	resp, err := client.Get(fmt.Sprintf("%s/api/frame.jpeg?%s", h.apiURL, query.Encode()))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get snapshot: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read snapshot: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("%w: %s", ErrStreamNotFound, name)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("go2rtc API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+	return body, contentType, nil
+}
+
+// OpenMP4 打开流的MP4输出用于录像，由调用方关闭，ctx 取消时连接断开
+// GET /api/stream.mp4?src={name}
+func (h *Go2RTCProtocolHandler) OpenMP4(ctx context.Context, name string) (io.ReadCloser, error) {
+	query := neturl.Values{}
+	query.Set("src", name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/stream.mp4?%s", h.apiURL, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 录像为长连接，不使用普通请求的超时
+	client := &http.Client{Transport: h.client.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mp4 stream: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrStreamNotFound, name)
+	}
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("go2rtc API error: %d - %s", resp.StatusCode, string(body))
+	}
+	return resp.Body, nil
+}
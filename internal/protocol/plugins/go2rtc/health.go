@@ -0,0 +1,96 @@
+// internal/protocol/plugins/go2rtc/health.go
+package go2rtc
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// AccessPointHealth 接入点的go2rtc可达性与同步延迟
+type AccessPointHealth struct {
+	AccessPointID  string     `json:"access_point_id"`
+	Go2RTCURL      string     `json:"go2rtc_url"`
+	Reachable      bool       `json:"reachable"`
+	LatencyMs      int64      `json:"latency_ms"`
+	Error          string     `json:"error,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	SyncLagSec     int64      `json:"sync_lag_sec"`     // 距最近一次成功同步的秒数，从未成功时为-1
+	SyncDurationMs int64      `json:"sync_duration_ms"` // 最近一次同步耗时
+	SyncedDevices  int        `json:"synced_devices"`
+	DeadLetters    int        `json:"dead_letters"`
+}
+
+// Health 检查全部接入点的go2rtc并汇总同步延迟，各接入点并发检查
+func (m *SyncManager) Health() []AccessPointHealth {
+	services := m.Services()
+	result := make([]AccessPointHealth, len(services))
+
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, service *DeviceSyncService) {
+			defer wg.Done()
+			result[i] = service.health(time.Now())
+		}(i, service)
+	}
+	wg.Wait()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AccessPointID < result[j].AccessPointID
+	})
+	return result
+}
+
+// Resync 平台恢复后触发全部接入点立即同步
+func (m *SyncManager) Resync() []SyncJob {
+	services := m.Services()
+	jobs := make([]SyncJob, 0, len(services))
+	for _, service := range services {
+		jobs = append(jobs, service.enqueue(SyncTriggerRecovery))
+	}
+	return jobs
+}
+
+// ResyncAccessPoints 触发指定接入点立即同步，未运行同步服务的接入点忽略
+func (m *SyncManager) ResyncAccessPoints(accessPointIDs []string) []SyncJob {
+	jobs := make([]SyncJob, 0, len(accessPointIDs))
+	for _, id := range accessPointIDs {
+		if service, ok := m.GetService(id); ok {
+			jobs = append(jobs, service.enqueue(SyncTriggerRecovery))
+		}
+	}
+	return jobs
+}
+
+// ReloadForRecovery 平台恢复时重新加载接入点
+// 新建或重建的同步服务启动时已完成首轮同步，调用方只需对未变化的接入点补充同步
+func (m *SyncManager) ReloadForRecovery() (ReloadResult, error) {
+	return m.reload(ReloadTriggerRecovery)
+}
+
+// health 单个接入点的健康状态
+func (s *DeviceSyncService) health(now time.Time) AccessPointHealth {
+	status := s.Status()
+	h := AccessPointHealth{
+		AccessPointID:  s.accessPointID,
+		Go2RTCURL:      status.Go2RTCURL,
+		LastSuccessAt:  status.LastSuccessAt,
+		SyncLagSec:     -1,
+		SyncDurationMs: status.LastDurationMs,
+		SyncedDevices:  len(status.SyncedDevices),
+		DeadLetters:    status.DeadLetterCount,
+	}
+	if status.LastSuccessAt != nil {
+		h.SyncLagSec = int64(now.Sub(*status.LastSuccessAt) / time.Second)
+	}
+
+	latency, err := s.handler.Ping()
+	h.LatencyMs = latency.Milliseconds()
+	if err != nil {
+		h.Error = err.Error()
+	} else {
+		h.Reachable = true
+	}
+	return h
+}
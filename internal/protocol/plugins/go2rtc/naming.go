@@ -0,0 +1,211 @@
+// internal/protocol/plugins/go2rtc/naming.go
+package go2rtc
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// 默认设备名称模板，与动态注册的历史命名一致
+const defaultDeviceNameTemplate = "{{.ServiceIdentifier}}-{{.StreamName}}"
+
+// NamingConfig 设备命名与元数据模板配置
+// 模板使用 text/template 语法，可用字段见 NamingData
+type NamingConfig struct {
+	ServiceIdentifier string
+	DeviceName        string            // 设备名称模板
+	Description       string            // 设备描述模板，作为 description 属性上报
+	Labels            []string          // 标签模板，作为 labels 属性上报(逗号分隔)
+	Attributes        map[string]string // 初始属性模板
+	NamePattern       string            // 流名称解析正则，命名分组作为属性上报，如 site/area/camera
+}
+
+// NamingData 命名模板可用数据
+type NamingData struct {
+	ServiceIdentifier string
+	StreamName        string
+	SourceURL         string            // 已隐藏密码的源地址
+	SourceScheme      string            // 源协议，如 rtsp、ffmpeg
+	SourceHost        string            // 源主机(不含端口)
+	Codec             string            // 编码列表，逗号分隔
+	Fields            map[string]string // 从流名称解析出的字段
+}
+
+// DeviceMeta 注册设备时使用的名称和元数据
+type DeviceMeta struct {
+	Name       string
+	Attributes map[string]interface{}
+}
+
+// DeviceNamer 按模板生成设备名称和初始属性
+type DeviceNamer struct {
+	serviceIdentifier string
+	name              *template.Template
+	description       *template.Template
+	labels            []*template.Template
+	attributes        map[string]*template.Template
+	pattern           *regexp.Regexp
+}
+
+// NewDeviceNamer 编译命名模板
+func NewDeviceNamer(cfg NamingConfig) (*DeviceNamer, error) {
+	if cfg.DeviceName == "" {
+		cfg.DeviceName = defaultDeviceNameTemplate
+	}
+
+	n := &DeviceNamer{
+		serviceIdentifier: cfg.ServiceIdentifier,
+		attributes:        make(map[string]*template.Template, len(cfg.Attributes)),
+	}
+
+	var err error
+	if n.name, err = parseNamingTemplate("device_name", cfg.DeviceName); err != nil {
+		return nil, err
+	}
+	if cfg.Description != "" {
+		if n.description, err = parseNamingTemplate("description", cfg.Description); err != nil {
+			return nil, err
+		}
+	}
+	for i, label := range cfg.Labels {
+		tmpl, err := parseNamingTemplate(fmt.Sprintf("labels[%d]", i), label)
+		if err != nil {
+			return nil, err
+		}
+		n.labels = append(n.labels, tmpl)
+	}
+	for key, text := range cfg.Attributes {
+		tmpl, err := parseNamingTemplate("attributes."+key, text)
+		if err != nil {
+			return nil, err
+		}
+		n.attributes[key] = tmpl
+	}
+	if cfg.NamePattern != "" {
+		if n.pattern, err = regexp.Compile(cfg.NamePattern); err != nil {
+			return nil, fmt.Errorf("无效的流名称解析规则: %v", err)
+		}
+	}
+
+	return n, nil
+}
+
+func parseNamingTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析命名模板 %s 失败: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// Render 生成设备名称和初始属性
+func (n *DeviceNamer) Render(stream StreamInfo) (DeviceMeta, error) {
+	data := n.data(stream)
+	meta := DeviceMeta{Attributes: make(map[string]interface{})}
+
+	var err error
+	if meta.Name, err = execNamingTemplate(n.name, data); err != nil {
+		return meta, err
+	}
+	if meta.Name == "" {
+		meta.Name = n.serviceIdentifier + "-" + stream.Name
+	}
+
+	// 解析出的字段直接作为属性，模板属性可以覆盖
+	for key, value := range data.Fields {
+		meta.Attributes[key] = value
+	}
+	if n.description != nil {
+		description, err := execNamingTemplate(n.description, data)
+		if err != nil {
+			return meta, err
+		}
+		meta.Attributes["description"] = description
+	}
+	if len(n.labels) > 0 {
+		labels := make([]string, 0, len(n.labels))
+		for _, tmpl := range n.labels {
+			label, err := execNamingTemplate(tmpl, data)
+			if err != nil {
+				return meta, err
+			}
+			if label != "" {
+				labels = append(labels, label)
+			}
+		}
+		meta.Attributes["labels"] = strings.Join(labels, ",")
+	}
+
+	keys := make([]string, 0, len(n.attributes))
+	for key := range n.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := execNamingTemplate(n.attributes[key], data)
+		if err != nil {
+			return meta, err
+		}
+		meta.Attributes[key] = value
+	}
+
+	return meta, nil
+}
+
+// data 构造模板数据
+func (n *DeviceNamer) data(stream StreamInfo) NamingData {
+	data := NamingData{
+		ServiceIdentifier: n.serviceIdentifier,
+		StreamName:        stream.Name,
+		Codec:             strings.Join(stream.Codecs, ","),
+		Fields:            make(map[string]string),
+	}
+
+	if stream.URL != "" {
+		scheme, u := parseSource(stream.URL)
+		data.SourceScheme = scheme
+		if u != nil {
+			data.SourceHost = u.Hostname()
+			data.SourceURL = u.Redacted()
+		} else {
+			data.SourceURL = stream.URL
+		}
+	}
+
+	if n.pattern != nil {
+		if m := n.pattern.FindStringSubmatch(stream.Name); m != nil {
+			for i, group := range n.pattern.SubexpNames() {
+				if i > 0 && group != "" {
+					data.Fields[group] = m[i]
+				}
+			}
+		}
+	}
+
+	return data
+}
+
+func execNamingTemplate(tmpl *template.Template, data NamingData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("渲染命名模板 %s 失败: %v", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// parseSource 解析源地址的协议，能按URL解析时同时返回解析结果
+// ffmpeg:{流名称}#video=h264 这类不是URL的源只返回协议
+func parseSource(raw string) (string, *url.URL) {
+	if u, err := url.Parse(raw); err == nil && u.Scheme != "" {
+		return u.Scheme, u
+	}
+	if i := strings.IndexByte(raw, ':'); i > 0 {
+		return raw[:i], nil
+	}
+	return "", nil
+}
@@ -0,0 +1,297 @@
+// internal/protocol/plugins/go2rtc/nvr.go
+package go2rtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	formjson "tp-plugin/internal/form_json"
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NVR通道数上限
+const maxNVRChannels = 256
+
+// nvrChannelPattern NVR通道流命名规则: {nvr}_ch{N} / {nvr}_ch{N}_sub
+var nvrChannelPattern = regexp.MustCompile(`^(.+)_ch(\d+)(_sub)?$`)
+
+// NVRChannelStreamName 生成NVR通道的go2rtc流名称
+func NVRChannelStreamName(nvrNumber string, channel int, streamType string) string {
+	name := fmt.Sprintf("%s_ch%d", nvrNumber, channel)
+	if streamType == StreamTypeSub {
+		name += "_sub"
+	}
+	return name
+}
+
+// parseNVRChannelStream 解析NVR通道流名称，返回NVR编号、通道号和是否为子码流
+func parseNVRChannelStream(name string) (string, int, bool, bool) {
+	m := nvrChannelPattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", 0, false, false
+	}
+	channel, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, false, false
+	}
+	return m[1], channel, m[3] != "", true
+}
+
+// NVRRegistry 已展开过通道的NVR网关
+// 只有前缀是已知NVR编号的 {nvr}_ch{N} 流才按NVR通道处理，用户自己命名的 lobby_ch1 等流照常同步；
+// 记录持久化，保证重启后首轮同步不会把通道流当作直连设备注册
+type NVRRegistry struct {
+	path   string
+	logger *logrus.Logger
+
+	mu   sync.Mutex
+	nvrs map[string]int // NVR编号 -> 通道数
+}
+
+// NewNVRRegistry 创建NVR记录并加载已有记录，path 为空时仅保存在内存
+func NewNVRRegistry(path string, logger *logrus.Logger) (*NVRRegistry, error) {
+	r := &NVRRegistry{path: path, logger: logger, nvrs: make(map[string]int)}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("读取NVR记录文件失败: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &r.nvrs); err != nil {
+			return nil, fmt.Errorf("解析NVR记录文件失败: %v", err)
+		}
+	}
+	return r, nil
+}
+
+// Add 记录NVR及其通道数
+func (r *NVRRegistry) Add(nvrNumber string, channels int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nvrs[nvrNumber] == channels {
+		return
+	}
+	r.nvrs[nvrNumber] = channels
+	r.saveLocked()
+}
+
+// IsChannelStream 判断流是否由已知NVR的通道展开生成
+// 这类流由NVRManager以子设备方式管理，不参与直连设备同步
+func (r *NVRRegistry) IsChannelStream(name string) bool {
+	if r == nil {
+		return false
+	}
+	owner, _, _, ok := parseNVRChannelStream(name)
+	if !ok {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, known := r.nvrs[owner]
+	return known
+}
+
+// saveLocked 持久化NVR记录，调用方需持有锁
+func (r *NVRRegistry) saveLocked() {
+	if r.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(r.nvrs, "", "  ")
+	if err != nil {
+		r.logger.WithError(err).Error("序列化NVR记录失败")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		r.logger.WithError(err).Error("创建NVR记录目录失败")
+		return
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		r.logger.WithError(err).Error("写入NVR记录文件失败")
+		return
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		r.logger.WithError(err).Error("写入NVR记录文件失败")
+	}
+}
+
+// NVRManager NVR通道管理
+// 将一个NVR网关设备展开为每通道一组go2rtc流(主/子码流)和一个子设备
+type NVRManager struct {
+	handler        *Go2RTCProtocolHandler
+	platformClient platform.Client
+	registry       *NVRRegistry
+	logger         *logrus.Logger
+	mu             sync.Mutex // 串行化NVR同步，避免并发通知重复建流
+}
+
+// NewNVRManager 创建NVR通道管理器，registry 为nil时使用仅保存在内存的记录
+func NewNVRManager(handler *Go2RTCProtocolHandler, platformClient platform.Client, registry *NVRRegistry, logger *logrus.Logger) *NVRManager {
+	if registry == nil {
+		registry, _ = NewNVRRegistry("", logger)
+	}
+	return &NVRManager{
+		handler:        handler,
+		platformClient: platformClient,
+		registry:       registry,
+		logger:         logger,
+	}
+}
+
+// SyncNVR 按凭证同步NVR通道
+// 新增通道会创建流并注册子设备，通道数减少时移除多余的流并将子设备置为离线
+func (m *NVRManager) SyncNVR(nvrNumber string, voucher formjson.NVRVoucher) error {
+	channelCount := int(voucher.ChannelCount)
+	if channelCount <= 0 || channelCount > maxNVRChannels {
+		return fmt.Errorf("NVR通道数无效: %d (1-%d)", channelCount, maxNVRChannels)
+	}
+	if _, ok := FindURLTemplate(voucher.Brand); !ok {
+		return fmt.Errorf("不支持的NVR品牌: %s", voucher.Brand)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 先记录NVR，同步服务随后不再把通道流当作直连设备
+	m.registry.Add(nvrNumber, channelCount)
+
+	streams, err := m.handler.ListStreams()
+	if err != nil {
+		return fmt.Errorf("获取go2rtc streams失败: %v", err)
+	}
+	existing := make(map[string]string, len(streams))
+	for _, stream := range streams {
+		existing[stream.Name] = stream.URL
+	}
+
+	logger := m.logger.WithFields(logrus.Fields{
+		"nvr":           nvrNumber,
+		"brand":         voucher.Brand,
+		"channel_count": channelCount,
+	})
+
+	for channel := 1; channel <= channelCount; channel++ {
+		urls := make(map[string]string, 2)
+		for _, streamType := range []string{StreamTypeMain, StreamTypeSub} {
+			streamURL, err := RenderStreamURL(voucher.Brand, URLParams{
+				Host:     voucher.Host,
+				Port:     int(voucher.Port),
+				Username: voucher.Username,
+				Password: voucher.Password,
+				Channel:  channel,
+				Stream:   streamType,
+			})
+			if err != nil {
+				return err
+			}
+			urls[streamType] = streamURL
+
+			name := NVRChannelStreamName(nvrNumber, channel, streamType)
+			if existing[name] == streamURL {
+				continue
+			}
+			if err := m.handler.AddStream(name, streamURL); err != nil {
+				logger.WithError(err).Errorf("添加NVR通道流失败: %s", name)
+			}
+		}
+
+		if err := m.registerChannel(nvrNumber, channel, urls); err != nil {
+			logger.WithError(err).Errorf("注册NVR通道子设备失败: 通道%d", channel)
+		}
+	}
+
+	// 清理超出通道数的流
+	for name := range existing {
+		owner, channel, isSub, ok := parseNVRChannelStream(name)
+		if !ok || owner != nvrNumber || channel <= channelCount {
+			continue
+		}
+		if err := m.handler.RemoveStream(name); err != nil {
+			logger.WithError(err).Warnf("移除NVR通道流失败: %s", name)
+			continue
+		}
+		if !isSub {
+			m.sendChannelOffline(name)
+		}
+		logger.Infof("NVR通道流已移除: %s", name)
+	}
+
+	logger.Info("NVR通道同步完成")
+	return nil
+}
+
+// registerChannel 注册NVR通道子设备并上报流地址
+func (m *NVRManager) registerChannel(nvrNumber string, channel int, urls map[string]string) error {
+	deviceNumber := NVRChannelStreamName(nvrNumber, channel, StreamTypeMain)
+
+	var deviceID string
+	result, err := m.platformClient.SubDeviceDynamicRegister(deviceNumber, strconv.Itoa(channel), nvrNumber)
+	if err != nil {
+		if !errors.Is(err, platform.ErrAlreadyExists) {
+			return err
+		}
+		device, errGet := m.platformClient.GetDevice(deviceNumber)
+		if errGet != nil {
+			return fmt.Errorf("子设备已存在但获取信息失败: %w", errGet)
+		}
+		deviceID = device.ID
+	} else {
+		deviceID = result.DeviceID
+		m.logger.WithFields(logrus.Fields{
+			"device_id":     deviceID,
+			"device_number": deviceNumber,
+			"nvr":           nvrNumber,
+		}).Info("NVR通道子设备注册成功")
+	}
+
+	if err := m.platformClient.SendDeviceStatus(deviceID, platform.DeviceStatusOnline); err != nil {
+		m.logger.WithError(err).Warn("发送通道在线状态失败")
+	}
+	emitEvent(m.platformClient, m.logger, deviceID, EventStreamStarted, map[string]interface{}{
+		"stream_name": deviceNumber,
+		"stream_url":  redactURL(urls[StreamTypeMain]),
+		"nvr":         nvrNumber,
+		"channel":     channel,
+	})
+
+	attrs := map[string]interface{}{
+		"nvr":           nvrNumber,
+		"channel":       channel,
+		"stream_url":    urls[StreamTypeMain],
+		"substream_url": urls[StreamTypeSub],
+	}
+	if err := m.platformClient.SendAttributes(deviceID, attrs); err != nil {
+		m.logger.WithError(err).Warn("发送通道属性失败")
+	}
+
+	return nil
+}
+
+// sendChannelOffline 发送通道子设备离线状态
+func (m *NVRManager) sendChannelOffline(deviceNumber string) {
+	device, err := m.platformClient.GetDevice(deviceNumber)
+	if err != nil {
+		m.logger.WithError(err).Warnf("获取通道子设备失败: %s", deviceNumber)
+		return
+	}
+	if err := m.platformClient.SendDeviceStatus(device.ID, platform.DeviceStatusOffline); err != nil {
+		m.logger.WithError(err).Warnf("发送通道离线状态失败: %s", deviceNumber)
+	}
+	emitEvent(m.platformClient, m.logger, device.ID, EventStreamLost, map[string]interface{}{
+		"stream_name": deviceNumber,
+		"reason":      offboardReasonRemoved,
+	})
+}
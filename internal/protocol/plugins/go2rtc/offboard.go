@@ -0,0 +1,299 @@
+// internal/protocol/plugins/go2rtc/offboard.go
+package go2rtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"tp-plugin/internal/pkg/logger"
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OffboardPolicy 流从go2rtc移除(或被过滤规则排除)后的设备处理策略
+type OffboardPolicy string
+
+const (
+	// OffboardKeepOffline 仅将设备置为离线(默认)
+	OffboardKeepOffline OffboardPolicy = "offline"
+	// OffboardDecommission 离线超过指定天数后上报 decommissioned 属性
+	// 插件API不提供删除设备接口，适配器不会删除平台上的设备记录
+	OffboardDecommission OffboardPolicy = "decommission"
+)
+
+// 下线相关属性
+const (
+	attrDecommissioned   = "decommissioned"
+	attrDecommissionedAt = "decommissioned_at"
+)
+
+// OffboardConfig 下线策略配置
+type OffboardConfig struct {
+	Policy            OffboardPolicy
+	DecommissionAfter time.Duration // decommission 策略的等待时长
+	StateFile         string        // 待下线设备状态文件，为空时仅保存在内存
+}
+
+// offboardEntry 已移除设备的记录
+type offboardEntry struct {
+	AccessPointID  string    `json:"access_point_id"`
+	DeviceID       string    `json:"device_id"`
+	Reason         string    `json:"reason"`
+	RemovedAt      time.Time `json:"removed_at"`
+	Decommissioned bool      `json:"decommissioned"`
+}
+
+// Offboarder 执行下线策略并记录审计日志
+// 已移除设备的记录会持久化，保证重启后仍能按天数完成停用
+type Offboarder struct {
+	platformClient platform.Client
+	logger         *logrus.Logger
+	cfg            OffboardConfig
+
+	mu      sync.Mutex
+	entries map[string]*offboardEntry // 设备编号 -> 记录
+}
+
+// NewOffboarder 创建下线策略执行器并加载已有记录
+func NewOffboarder(platformClient platform.Client, logger *logrus.Logger, cfg OffboardConfig) (*Offboarder, error) {
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = OffboardKeepOffline
+	case OffboardKeepOffline, OffboardDecommission:
+	case "deregister":
+		return nil, fmt.Errorf("不支持的下线策略: %s，插件API不提供删除设备接口，请使用 decommission 并在平台侧删除设备", cfg.Policy)
+	default:
+		return nil, fmt.Errorf("不支持的下线策略: %s", cfg.Policy)
+	}
+	if cfg.Policy == OffboardDecommission && cfg.DecommissionAfter <= 0 {
+		cfg.DecommissionAfter = 7 * 24 * time.Hour
+	}
+
+	o := &Offboarder{
+		platformClient: platformClient,
+		logger:         logger,
+		cfg:            cfg,
+		entries:        make(map[string]*offboardEntry),
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"policy":             cfg.Policy,
+		"decommission_after": cfg.DecommissionAfter,
+		"pending":            len(o.entries),
+	}).Info("下线策略已加载")
+	return o, nil
+}
+
+// Policy 当前下线策略
+func (o *Offboarder) Policy() OffboardPolicy {
+	return o.cfg.Policy
+}
+
+// Offboard 处理已移除的设备
+func (o *Offboarder) Offboard(accessPointID, deviceNumber, reason string) {
+	device, err := o.platformClient.GetDevice(deviceNumber)
+	if err != nil {
+		o.logger.WithError(err).Warnf("获取设备信息失败: %s", deviceNumber)
+		return
+	}
+
+	audit := map[string]interface{}{
+		"access_point":  accessPointID,
+		"device_number": deviceNumber,
+		"device_id":     device.ID,
+		"reason":        reason,
+		"policy":        string(o.cfg.Policy),
+	}
+
+	if err := o.platformClient.SendDeviceStatus(device.ID, platform.DeviceStatusOffline); err != nil {
+		o.logger.WithError(err).Warnf("发送设备离线状态失败: %s", deviceNumber)
+		audit["error"] = err.Error()
+	}
+	logger.LogAudit("offline", audit)
+	emitEvent(o.platformClient, o.logger, device.ID, EventStreamLost, map[string]interface{}{
+		"stream_name":  deviceNumber,
+		"access_point": accessPointID,
+		"reason":       reason,
+		"policy":       string(o.cfg.Policy),
+	})
+
+	switch o.cfg.Policy {
+	case OffboardDecommission:
+		o.mu.Lock()
+		if _, exists := o.entries[deviceNumber]; !exists {
+			o.entries[deviceNumber] = &offboardEntry{
+				AccessPointID: accessPointID,
+				DeviceID:      device.ID,
+				Reason:        reason,
+				RemovedAt:     time.Now(),
+			}
+			o.saveLocked()
+		}
+		o.mu.Unlock()
+		delete(audit, "error")
+		audit["decommission_at"] = time.Now().Add(o.cfg.DecommissionAfter).Format(time.RFC3339)
+		logger.LogAudit("schedule_decommission", audit)
+	}
+}
+
+// Restore 设备对应的流重新出现时撤销下线记录
+func (o *Offboarder) Restore(deviceNumber, deviceID string) {
+	o.mu.Lock()
+	entry, exists := o.entries[deviceNumber]
+	if exists {
+		delete(o.entries, deviceNumber)
+		o.saveLocked()
+	}
+	o.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	audit := map[string]interface{}{
+		"access_point":  entry.AccessPointID,
+		"device_number": deviceNumber,
+		"device_id":     deviceID,
+	}
+	if entry.Decommissioned {
+		attrs := map[string]interface{}{attrDecommissioned: false}
+		if err := o.platformClient.SendAttributes(deviceID, attrs); err != nil {
+			o.logger.WithError(err).Warnf("撤销停用属性失败: %s", deviceNumber)
+			audit["error"] = err.Error()
+		}
+	}
+	logger.LogAudit("restore", audit)
+}
+
+// CheckExpired 对离线超过期限的设备执行停用
+func (o *Offboarder) CheckExpired() {
+	if o.cfg.Policy != OffboardDecommission {
+		return
+	}
+
+	o.mu.Lock()
+	due := make(map[string]*offboardEntry)
+	for number, entry := range o.entries {
+		if !entry.Decommissioned && time.Since(entry.RemovedAt) >= o.cfg.DecommissionAfter {
+			due[number] = entry
+		}
+	}
+	o.mu.Unlock()
+
+	for number, entry := range due {
+		o.decommission(number, entry)
+	}
+
+	if len(due) > 0 {
+		o.mu.Lock()
+		o.saveLocked()
+		o.mu.Unlock()
+	}
+}
+
+// Due 获取指定接入点已到停用期限、下一轮同步将停用的设备编号
+func (o *Offboarder) Due(accessPointID string) []string {
+	if o.cfg.Policy != OffboardDecommission {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var due []string
+	for number, entry := range o.entries {
+		if entry.AccessPointID == accessPointID && !entry.Decommissioned &&
+			time.Since(entry.RemovedAt) >= o.cfg.DecommissionAfter {
+			due = append(due, number)
+		}
+	}
+	sort.Strings(due)
+	return due
+}
+
+// decommission 上报停用属性并记录审计
+func (o *Offboarder) decommission(deviceNumber string, entry *offboardEntry) {
+	audit := map[string]interface{}{
+		"access_point":  entry.AccessPointID,
+		"device_number": deviceNumber,
+		"device_id":     entry.DeviceID,
+		"reason":        entry.Reason,
+		"removed_at":    entry.RemovedAt.Format(time.RFC3339),
+	}
+
+	attrs := map[string]interface{}{
+		attrDecommissioned:   true,
+		attrDecommissionedAt: time.Now().Format(time.RFC3339),
+	}
+	if err := o.platformClient.SendAttributes(entry.DeviceID, attrs); err != nil {
+		o.logger.WithError(err).Warnf("上报停用属性失败: %s", deviceNumber)
+		audit["error"] = err.Error()
+		logger.LogAudit("decommission", audit)
+		return
+	}
+
+	o.mu.Lock()
+	entry.Decommissioned = true
+	o.mu.Unlock()
+	logger.LogAudit("decommission", audit)
+	emitEvent(o.platformClient, o.logger, entry.DeviceID, EventDeviceDecommissioned, map[string]interface{}{
+		"stream_name": deviceNumber,
+		"reason":      entry.Reason,
+		"removed_at":  entry.RemovedAt.Format(time.RFC3339),
+	})
+}
+
+// load 加载持久化的下线记录
+func (o *Offboarder) load() error {
+	if o.cfg.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(o.cfg.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取下线状态文件失败: %v", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, &o.entries); err != nil {
+		return fmt.Errorf("解析下线状态文件失败: %v", err)
+	}
+	return nil
+}
+
+// saveLocked 持久化下线记录，调用方需持有锁
+func (o *Offboarder) saveLocked() {
+	if o.cfg.StateFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(o.entries, "", "  ")
+	if err != nil {
+		o.logger.WithError(err).Error("序列化下线状态失败")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(o.cfg.StateFile), 0755); err != nil {
+		o.logger.WithError(err).Error("创建下线状态目录失败")
+		return
+	}
+
+	tmp := o.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		o.logger.WithError(err).Error("写入下线状态文件失败")
+		return
+	}
+	if err := os.Rename(tmp, o.cfg.StateFile); err != nil {
+		o.logger.WithError(err).Error("写入下线状态文件失败")
+	}
+}
@@ -0,0 +1,201 @@
+// internal/protocol/plugins/go2rtc/recorder.go
+package go2rtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 录像或抓图失败后的重试间隔
+const workerRetryDelay = 5 * time.Second
+
+// streamWorkers 单个流的录像与定时抓图任务
+type streamWorkers struct {
+	handler func() (*Go2RTCProtocolHandler, error) // 每次录像、抓图时获取go2rtc客户端，接入点重建后使用新的客户端
+	stream  string
+	cfg     ControlConfig
+	logger  *logrus.Entry
+
+	mu             sync.Mutex
+	recordCancel   context.CancelFunc
+	snapshotCancel context.CancelFunc
+	interval       time.Duration
+}
+
+func newStreamWorkers(handler func() (*Go2RTCProtocolHandler, error), stream string, cfg ControlConfig, logger *logrus.Entry) *streamWorkers {
+	return &streamWorkers{
+		handler: handler,
+		stream:  stream,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+// setRecording 启停录像
+func (w *streamWorkers) setRecording(on bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch {
+	case on && w.recordCancel == nil:
+		if w.cfg.RecordingDir == "" {
+			w.logger.Warn("未配置录像目录，无法录像")
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		w.recordCancel = cancel
+		go w.record(ctx)
+		w.logger.Info("开始录像")
+	case !on && w.recordCancel != nil:
+		w.recordCancel()
+		w.recordCancel = nil
+		w.logger.Info("停止录像")
+	}
+}
+
+// setSnapshotInterval 调整定时抓图间隔，0为停止
+func (w *streamWorkers) setSnapshotInterval(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if interval == w.interval {
+		return
+	}
+	if w.snapshotCancel != nil {
+		w.snapshotCancel()
+		w.snapshotCancel = nil
+	}
+	w.interval = interval
+	if interval == 0 {
+		w.logger.Info("停止定时抓图")
+		return
+	}
+	if w.cfg.SnapshotDir == "" {
+		w.logger.Warn("未配置抓图目录，无法定时抓图")
+		w.interval = 0
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.snapshotCancel = cancel
+	go w.snapshotLoop(ctx, interval)
+	w.logger.Infof("定时抓图间隔: %v", interval)
+}
+
+// stop 停止全部任务
+func (w *streamWorkers) stop() {
+	w.setRecording(false)
+	w.setSnapshotInterval(0)
+}
+
+// record 按固定时长分段录像，go2rtc断开后稍后重连
+func (w *streamWorkers) record(ctx context.Context) {
+	dir := filepath.Join(w.cfg.RecordingDir, safeFileName(w.stream))
+	for {
+		err := w.recordSegment(ctx, dir)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		w.logger.WithError(err).Warn("录像中断，稍后重试")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(workerRetryDelay):
+		}
+	}
+}
+
+// recordSegment 录制一个分段，到达分段时长后正常返回
+func (w *streamWorkers) recordSegment(ctx context.Context, dir string) error {
+	segmentCtx, cancel := context.WithTimeout(ctx, w.cfg.RecordingSegment)
+	defer cancel()
+
+	handler, err := w.handler()
+	if err != nil {
+		return err
+	}
+	body, err := handler.OpenMP4(segmentCtx, w.stream)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+".mp4")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, body)
+	w.logger.Debugf("录像分段已保存: %s (%d 字节)", path, n)
+	if errors.Is(segmentCtx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("go2rtc closed the stream")
+	}
+	return err
+}
+
+// snapshotLoop 定时抓图，最新一张保存为 latest.jpg
+func (w *streamWorkers) snapshotLoop(ctx context.Context, interval time.Duration) {
+	dir := filepath.Join(w.cfg.SnapshotDir, safeFileName(w.stream))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		handler, err := w.handler()
+		if err != nil {
+			w.logger.WithError(err).Warn("定时抓图失败")
+			continue
+		}
+		image, _, err := handler.Snapshot(w.stream)
+		if err != nil {
+			w.logger.WithError(err).Warn("定时抓图失败")
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(dir, "latest.jpg"), image); err != nil {
+			w.logger.WithError(err).Warn("保存抓图失败")
+		}
+	}
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免读到写了一半的图片
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// safeFileName 流名称用作目录名时替换路径分隔符
+func safeFileName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(name)
+}
@@ -0,0 +1,210 @@
+// internal/protocol/plugins/go2rtc/status.go
+package go2rtc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 保留的同步任务记录数
+const maxSyncJobHistory = 50
+
+// 同步任务状态
+const (
+	SyncJobQueued  = "queued"
+	SyncJobRunning = "running"
+	SyncJobDone    = "done"
+	SyncJobFailed  = "failed"
+)
+
+// 同步任务触发方式
+const (
+	SyncTriggerSchedule = "schedule" // 定时同步
+	SyncTriggerStart    = "start"    // 同步服务启动后的首次同步
+	SyncTriggerManual   = "manual"   // 通过接口手动触发
+	SyncTriggerWatch    = "watch"    // go2rtc配置文件变化触发
+	SyncTriggerRecovery = "recovery" // 平台心跳连续失败后的恢复同步
+)
+
+// SyncResult 一轮同步的结果
+type SyncResult struct {
+	Added    int      `json:"added"`    // 新注册的设备
+	Updated  int      `json:"updated"`  // 平台已存在、刷新状态和属性的设备
+	Removed  int      `json:"removed"`  // 按下线策略处理的设备
+	Filtered int      `json:"filtered"` // 被过滤规则排除的流
+	Failed   int      `json:"failed"`   // 重试后仍失败的设备
+	Errors   []string `json:"errors"`
+}
+
+// SyncJob 同步任务
+type SyncJob struct {
+	ID            string      `json:"id"`
+	AccessPointID string      `json:"access_point_id"`
+	Trigger       string      `json:"trigger"`
+	Status        string      `json:"status"`
+	RequestedAt   time.Time   `json:"requested_at"`
+	StartedAt     *time.Time  `json:"started_at,omitempty"`
+	FinishedAt    *time.Time  `json:"finished_at,omitempty"`
+	Result        *SyncResult `json:"result,omitempty"`
+}
+
+// SyncStatus 接入点同步状态
+type SyncStatus struct {
+	AccessPointID   string      `json:"access_point_id"`
+	Go2RTCURL       string      `json:"go2rtc_url"`
+	SyncInterval    string      `json:"sync_interval"`
+	AuthEnabled     bool        `json:"auth_enabled"`  // 是否使用go2rtc API认证
+	ConfiguredAt    time.Time   `json:"configured_at"` // 按当前接入点凭证创建go2rtc客户端和同步服务的时间
+	Running         bool        `json:"running"`
+	LastSyncAt      *time.Time  `json:"last_sync_at,omitempty"`
+	LastSuccessAt   *time.Time  `json:"last_success_at,omitempty"` // 最近一次成功获取go2rtc流列表的同步
+	LastDurationMs  int64       `json:"last_duration_ms"`
+	LastResult      *SyncResult `json:"last_result,omitempty"`
+	LastJobID       string      `json:"last_job_id,omitempty"` // 最近一次手动或文件变化触发的同步任务
+	NextRunAt       *time.Time  `json:"next_run_at,omitempty"`
+	SyncedDevices   []string    `json:"synced_devices"`
+	DeadLetterCount int         `json:"dead_letter_count"`
+}
+
+// syncState 同步服务运行状态
+type syncState struct {
+	mu           sync.RWMutex
+	running      bool
+	lastSyncAt   time.Time
+	lastSuccess  time.Time
+	lastDuration time.Duration
+	lastResult   *SyncResult
+	lastJobID    string
+	nextRunAt    time.Time
+
+	jobs     map[string]*SyncJob
+	jobOrder []string // 按创建顺序，超出上限时淘汰最早的任务
+}
+
+func newSyncState() *syncState {
+	return &syncState{jobs: make(map[string]*SyncJob)}
+}
+
+// newJob 创建同步任务，只保留非定时任务的记录供查询
+func (st *syncState) newJob(accessPointID, trigger string) *SyncJob {
+	job := &SyncJob{
+		ID:            newJobID(),
+		AccessPointID: accessPointID,
+		Trigger:       trigger,
+		Status:        SyncJobQueued,
+		RequestedAt:   time.Now(),
+	}
+	if trigger == SyncTriggerSchedule {
+		return job
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.jobs[job.ID] = job
+	st.jobOrder = append(st.jobOrder, job.ID)
+	for len(st.jobOrder) > maxSyncJobHistory {
+		delete(st.jobs, st.jobOrder[0])
+		st.jobOrder = st.jobOrder[1:]
+	}
+	return job
+}
+
+// start 标记任务开始执行
+func (st *syncState) start(job *SyncJob) {
+	now := time.Now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.running = true
+	job.Status = SyncJobRunning
+	job.StartedAt = &now
+}
+
+// finish 记录任务结果
+func (st *syncState) finish(job *SyncJob, result *SyncResult, listErr error, nextRun time.Time) {
+	now := time.Now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	job.FinishedAt = &now
+	job.Result = result
+	job.Status = SyncJobDone
+	if listErr != nil {
+		job.Status = SyncJobFailed
+	}
+
+	st.running = false
+	st.lastSyncAt = now
+	if listErr == nil {
+		st.lastSuccess = now
+	}
+	if job.StartedAt != nil {
+		st.lastDuration = now.Sub(*job.StartedAt)
+	}
+	st.lastResult = result
+	if job.Trigger != SyncTriggerSchedule {
+		st.lastJobID = job.ID
+	}
+	st.nextRunAt = nextRun
+}
+
+// job 查询任务，返回副本
+func (st *syncState) job(id string) (SyncJob, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	job, ok := st.jobs[id]
+	if !ok {
+		return SyncJob{}, false
+	}
+	return *job, true
+}
+
+// queued 获取尚未开始执行的非定时任务
+func (st *syncState) queued() *SyncJob {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	for i := len(st.jobOrder) - 1; i >= 0; i-- {
+		job := st.jobs[st.jobOrder[i]]
+		if job.Status == SyncJobQueued {
+			return job
+		}
+	}
+	return nil
+}
+
+// fill 填充状态快照中的运行信息
+func (st *syncState) fill(status *SyncStatus) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	status.Running = st.running
+	if !st.lastSyncAt.IsZero() {
+		t := st.lastSyncAt
+		status.LastSyncAt = &t
+		status.LastDurationMs = st.lastDuration.Milliseconds()
+	}
+	if !st.lastSuccess.IsZero() {
+		t := st.lastSuccess
+		status.LastSuccessAt = &t
+	}
+	if st.lastResult != nil {
+		result := *st.lastResult
+		status.LastResult = &result
+	}
+	status.LastJobID = st.lastJobID
+	if !st.nextRunAt.IsZero() {
+		t := st.nextRunAt
+		status.NextRunAt = &t
+	}
+}
+
+// newJobID 生成同步任务ID
+func newJobID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("sync-%d", time.Now().UnixNano())
+	}
+	return "sync-" + hex.EncodeToString(buf)
+}
@@ -3,8 +3,9 @@ package go2rtc
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,29 +14,59 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// SyncOptions 同步服务选项
+type SyncOptions struct {
+	AccessPointID   string        // 服务接入点ID，为空表示未绑定接入点
+	SyncIntervalSec int           // 同步间隔(秒)，默认30秒
+	Filter          *StreamFilter // 流过滤规则，为nil表示全部同步
+	Namer           *DeviceNamer  // 设备命名模板，为nil时使用默认命名
+	Offboarder      *Offboarder   // 下线策略，为nil时仅发送离线状态
+	Controls        *ControlStore // 流控制状态，被禁用的流不按下线处理
+	Workers         int           // 并发注册的设备数，默认8
+	Retry           RetryPolicy   // 单设备注册失败的重试策略
+	NVRs            *NVRRegistry  // 已知的NVR，其通道流不参与同步，为nil表示没有NVR
+}
+
 // DeviceSyncService 设备同步服务
 // 从go2rtc定期获取streams列表并同步到ThingsPanel
 type DeviceSyncService struct {
 	handler        *Go2RTCProtocolHandler
-	platformClient *platform.PlatformClient
-	logger         *logrus.Logger
+	platformClient platform.Client
+	logger         *logrus.Entry
 
+	accessPointID string
+	filter        *StreamFilter
+	namer         *DeviceNamer
+	offboarder    *Offboarder
+	controls      *ControlStore
+	nvrs          *NVRRegistry
+	workers       int
+	retry         RetryPolicy
+	deadLetters   *deadLetterList
 	syncInterval  time.Duration
+	configuredAt  time.Time // 按当前接入点凭证创建的时间
+	state         *syncState
+	trigger       chan *SyncJob // 手动触发的同步任务
+	triggerMu     sync.Mutex
 	ctx           context.Context
 	cancel        context.CancelFunc
 	syncedDevices map[string]bool // 已同步设备列表 (stream name -> synced)
 	syncedMutex   sync.RWMutex
+	devices       *deviceIndex // 由 SyncManager 设置，为nil时不记录设备ID
 }
 
 // NewDeviceSyncService 创建设备同步服务
 func NewDeviceSyncService(
 	handler *Go2RTCProtocolHandler,
-	platformClient *platform.PlatformClient,
+	platformClient platform.Client,
 	logger *logrus.Logger,
-	syncIntervalSec int,
+	opts SyncOptions,
 ) *DeviceSyncService {
-	if syncIntervalSec <= 0 {
-		syncIntervalSec = 30 // 默认30秒
+	if opts.SyncIntervalSec <= 0 {
+		opts.SyncIntervalSec = 30 // 默认30秒
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultSyncWorkers
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -43,36 +74,57 @@ func NewDeviceSyncService(
 	return &DeviceSyncService{
 		handler:        handler,
 		platformClient: platformClient,
-		logger:         logger,
-		syncInterval:   time.Duration(syncIntervalSec) * time.Second,
+		logger:         logger.WithField("access_point", opts.AccessPointID),
+		accessPointID:  opts.AccessPointID,
+		filter:         opts.Filter,
+		namer:          opts.Namer,
+		offboarder:     opts.Offboarder,
+		controls:       opts.Controls,
+		nvrs:           opts.NVRs,
+		workers:        opts.Workers,
+		retry:          opts.Retry.withDefaults(),
+		deadLetters:    newDeadLetterList(),
+		syncInterval:   time.Duration(opts.SyncIntervalSec) * time.Second,
+		configuredAt:   time.Now(),
+		state:          newSyncState(),
+		trigger:        make(chan *SyncJob, 1),
 		ctx:            ctx,
 		cancel:         cancel,
 		syncedDevices:  make(map[string]bool),
 	}
 }
 
-// Start 启动同步服务
-func (s *DeviceSyncService) Start() {
-	s.logger.Infof("设备同步服务启动，间隔: %v", s.syncInterval)
+// Start 启动同步服务，返回首次同步任务
+// 首次同步在后台执行，不阻塞调用方(如配置通知)，其间手动触发的同步合并到该任务
+func (s *DeviceSyncService) Start() SyncJob {
+	s.logger.Infof("设备同步服务启动，间隔: %v, 并发: %d, go2rtc: %s", s.syncInterval, s.workers, s.handler.APIURL())
 
-	// 立即执行一次同步
-	s.syncDevices()
+	first := s.state.newJob(s.accessPointID, SyncTriggerStart)
+	started, _ := s.state.job(first.ID)
 
-	// 定时同步
+	// 定时同步，手动触发的任务插入执行，不影响定时节奏
 	go func() {
+		// 立即执行一次同步
+		nextRun := time.Now().Add(s.syncInterval)
+		s.runJob(first, nextRun)
+
 		ticker := time.NewTicker(s.syncInterval)
 		defer ticker.Stop()
 
 		for {
 			select {
-			case <-ticker.C:
-				s.syncDevices()
+			case tick := <-ticker.C:
+				nextRun = tick.Add(s.syncInterval)
+				s.runJob(s.state.newJob(s.accessPointID, SyncTriggerSchedule), nextRun)
+			case job := <-s.trigger:
+				s.runJob(job, nextRun)
 			case <-s.ctx.Done():
 				s.logger.Info("设备同步服务已停止")
 				return
 			}
 		}
 	}()
+	return started
 }
 
 // Stop 停止同步服务
@@ -82,94 +134,330 @@ func (s *DeviceSyncService) Stop() {
 	}
 }
 
+// Trigger 立即触发一次同步，返回同步任务
+// 已有排队中的任务时直接返回该任务
+func (s *DeviceSyncService) Trigger() SyncJob {
+	return s.enqueue(SyncTriggerManual)
+}
+
+// enqueue 将同步任务加入队列，已有排队中的任务时合并
+func (s *DeviceSyncService) enqueue(trigger string) SyncJob {
+	s.triggerMu.Lock()
+	defer s.triggerMu.Unlock()
+
+	if job := s.state.queued(); job != nil {
+		queued, _ := s.state.job(job.ID)
+		return queued
+	}
+
+	job := s.state.newJob(s.accessPointID, trigger)
+	s.trigger <- job
+	s.logger.Infof("已触发同步: %s (%s)", job.ID, trigger)
+
+	queued, _ := s.state.job(job.ID)
+	return queued
+}
+
+// Job 查询手动或文件变化触发的同步任务
+func (s *DeviceSyncService) Job(id string) (SyncJob, bool) {
+	return s.state.job(id)
+}
+
+// Status 获取同步状态
+func (s *DeviceSyncService) Status() SyncStatus {
+	status := SyncStatus{
+		AccessPointID:   s.accessPointID,
+		Go2RTCURL:       s.handler.APIURL(),
+		SyncInterval:    s.syncInterval.String(),
+		AuthEnabled:     s.handler.AuthEnabled(),
+		ConfiguredAt:    s.configuredAt,
+		SyncedDevices:   s.GetSyncedDevices(),
+		DeadLetterCount: len(s.deadLetters.list()),
+	}
+	sort.Strings(status.SyncedDevices)
+	s.state.fill(&status)
+	return status
+}
+
+// runJob 执行同步任务并记录结果
+func (s *DeviceSyncService) runJob(job *SyncJob, nextRun time.Time) {
+	s.state.start(job)
+	start := time.Now()
+	result, err := s.syncDevices()
+	s.state.finish(job, result, err, nextRun)
+
+	s.logger.WithFields(logrus.Fields{
+		"job":      job.ID,
+		"trigger":  job.Trigger,
+		"duration": time.Since(start).String(),
+		"added":    result.Added,
+		"updated":  result.Updated,
+		"removed":  result.Removed,
+		"failed":   result.Failed,
+	}).Debug("同步完成")
+}
+
+// 设备下线原因
+const (
+	offboardReasonRemoved  = "removed"  // 流已从go2rtc删除
+	offboardReasonFiltered = "filtered" // 流不再满足过滤规则
+)
+
+// offboardItem 需要下线的设备
+type offboardItem struct {
+	name   string
+	reason string
+}
+
+// syncPlan 一轮同步将执行的操作，仅根据当前状态计算，不产生副作用
+type syncPlan struct {
+	current  map[string]bool // 当前存在且通过过滤的streams
+	register []StreamInfo    // 待注册的设备
+	deferred []StreamInfo    // 在死信等待期内、本轮跳过的设备
+	synced   []StreamInfo    // 已同步且仍存在的设备
+	filtered []FilteredStream
+	offboard []offboardItem
+}
+
+// plan 计算一轮同步的操作
+func (s *DeviceSyncService) plan(streams []StreamInfo, now time.Time) syncPlan {
+	allStreams := make(map[string]bool, len(streams))
+	for _, stream := range streams {
+		allStreams[stream.Name] = true
+	}
+
+	p := syncPlan{current: make(map[string]bool)}
+
+	s.syncedMutex.RLock()
+	defer s.syncedMutex.RUnlock()
+
+	for _, stream := range streams {
+		// NVR通道流由NVRManager以子设备方式管理
+		if s.nvrs.IsChannelStream(stream.Name) {
+			continue
+		}
+		// 子码流随主流设备一起管理
+		if s.controls.Substream(s.accessPointID, stream.Name) {
+			continue
+		}
+		if ok, reason := s.filter.Match(stream, allStreams); !ok {
+			p.filtered = append(p.filtered, FilteredStream{Name: stream.Name, Reason: reason})
+			continue
+		}
+		p.current[stream.Name] = true
+
+		switch {
+		case s.syncedDevices[stream.Name]:
+			p.synced = append(p.synced, stream)
+		case s.deadLetters.blocked(stream, now):
+			// 死信等待期内的设备本轮跳过
+			p.deferred = append(p.deferred, stream)
+		default:
+			p.register = append(p.register, stream)
+		}
+	}
+
+	// 已同步但已删除或已被过滤规则排除的设备
+	for deviceName := range s.syncedDevices {
+		if p.current[deviceName] {
+			continue
+		}
+		// 通过控制禁用的流已从go2rtc移除，设备保留
+		if s.controls.Disabled(s.accessPointID, deviceName) {
+			continue
+		}
+		reason := offboardReasonRemoved
+		if allStreams[deviceName] {
+			reason = offboardReasonFiltered
+		}
+		p.offboard = append(p.offboard, offboardItem{name: deviceName, reason: reason})
+	}
+	sort.Slice(p.offboard, func(i, j int) bool {
+		return p.offboard[i].name < p.offboard[j].name
+	})
+
+	return p
+}
+
 // syncDevices 执行设备同步
-func (s *DeviceSyncService) syncDevices() {
+func (s *DeviceSyncService) syncDevices() (*SyncResult, error) {
+	result := &SyncResult{Errors: []string{}}
+
 	// 从go2rtc获取streams列表
 	streams, err := s.handler.ListStreams()
 	if err != nil {
 		s.logger.WithError(err).Error("获取go2rtc streams失败")
-		return
+		result.Errors = append(result.Errors, err.Error())
+		return result, err
 	}
 
 	s.logger.Debugf("从go2rtc获取到 %d 个streams", len(streams))
 
-	// 记录当前存在的streams
-	currentStreams := make(map[string]bool)
+	p := s.plan(streams, time.Now())
+	for _, f := range p.filtered {
+		s.logger.Debugf("流已被过滤: %s (%s)", f.Name, f.Reason)
+	}
+	for _, stream := range p.deferred {
+		s.logger.Debugf("设备在死信列表中，暂不重试: %s", stream.Name)
+	}
+	s.deadLetters.retain(p.current)
+	result.Filtered = len(p.filtered)
+
+	// 并发注册新设备
+	var resultMu sync.Mutex
+	runWorkers(s.ctx, s.workers, p.register, func(stream StreamInfo) {
+		created, err := s.syncStream(stream)
+		resultMu.Lock()
+		defer resultMu.Unlock()
+		switch {
+		case err != nil:
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", stream.Name, err))
+		case created:
+			result.Added++
+		default:
+			result.Updated++
+		}
+	})
 
-	// 同步新设备
-	for _, stream := range streams {
-		currentStreams[stream.Name] = true
-
-		// 检查是否已同步
-		s.syncedMutex.RLock()
-		synced := s.syncedDevices[stream.Name]
-		s.syncedMutex.RUnlock()
-
-		if !synced {
-			// 注册新设备
-			if err := s.registerDevice(stream); err != nil {
-				s.logger.WithError(err).Errorf("注册设备失败: %s", stream.Name)
-			} else {
-				s.syncedMutex.Lock()
-				s.syncedDevices[stream.Name] = true
-				s.syncedMutex.Unlock()
-				s.logger.Infof("设备已同步: %s", stream.Name)
-			}
+	// 已删除或已被过滤规则排除的设备，按下线策略处理
+	for _, item := range p.offboard {
+		s.offboardDevice(item.name, item.reason)
+		result.Removed++
+		s.syncedMutex.Lock()
+		delete(s.syncedDevices, item.name)
+		s.syncedMutex.Unlock()
+		if item.reason == offboardReasonFiltered {
+			s.logger.Infof("设备已被过滤规则排除: %s", item.name)
+		} else {
+			s.logger.Infof("设备已移除: %s", item.name)
 		}
 	}
 
-	// 检测已删除的streams (发送离线状态)
-	s.syncedMutex.Lock()
-	for deviceName := range s.syncedDevices {
-		if !currentStreams[deviceName] {
-			// 设备已从go2rtc移除，发送离线状态
-			s.sendDeviceOffline(deviceName)
-			delete(s.syncedDevices, deviceName)
-			s.logger.Infof("设备已移除: %s", deviceName)
+	// 到期的待停用设备
+	if s.offboarder != nil {
+		s.offboarder.CheckExpired()
+	}
+	return result, nil
+}
+
+// offboardDevice 按下线策略处理已移除的设备
+func (s *DeviceSyncService) offboardDevice(deviceName, reason string) {
+	if s.offboarder == nil {
+		s.sendDeviceOffline(deviceName, reason)
+		return
+	}
+	s.offboarder.Offboard(s.accessPointID, deviceName, reason)
+}
+
+// syncStream 注册单个设备，失败时按退避策略重试，仍失败则进入死信列表
+// 返回设备是否为新注册
+func (s *DeviceSyncService) syncStream(stream StreamInfo) (bool, error) {
+	firstFailed := time.Time{}
+	created := false
+	attempts, err := retry(s.ctx, s.retry, platform.IsRetryable, func() error {
+		var err error
+		created, err = s.registerDevice(stream)
+		if err != nil {
+			if firstFailed.IsZero() {
+				firstFailed = time.Now()
+			}
+			s.logger.WithError(err).Warnf("注册设备失败: %s", stream.Name)
 		}
+		return err
+	})
+
+	if err != nil {
+		now := time.Now()
+		s.deadLetters.add(DeadLetter{
+			AccessPointID: s.accessPointID,
+			StreamName:    stream.Name,
+			StreamURL:     redactURL(stream.URL),
+			rawURL:        stream.URL,
+			Attempts:      attempts,
+			LastError:     err.Error(),
+			ErrorCode:     platform.ErrorCode(err),
+			FirstFailedAt: firstFailed,
+			LastFailedAt:  now,
+			NextRetryAt:   now.Add(s.retry.DeadLetterRetry),
+		})
+		s.logger.WithError(err).Errorf("设备同步失败，已加入死信列表: %s (尝试%d次)", stream.Name, attempts)
+		return false, err
 	}
+
+	s.deadLetters.remove(stream.Name)
+	s.syncedMutex.Lock()
+	s.syncedDevices[stream.Name] = true
 	s.syncedMutex.Unlock()
+	s.logger.Infof("设备已同步: %s", stream.Name)
+	return created, nil
 }
 
-// registerDevice 注册设备到ThingsPanel
-func (s *DeviceSyncService) registerDevice(stream StreamInfo) error {
+// registerDevice 注册设备到ThingsPanel，返回设备是否为新注册
+func (s *DeviceSyncService) registerDevice(stream StreamInfo) (bool, error) {
 	var deviceID string
+	created := false
+
+	// 按模板生成设备名称和初始属性
+	meta := DeviceMeta{Attributes: map[string]interface{}{}}
+	if s.namer != nil {
+		var err error
+		if meta, err = s.namer.Render(stream); err != nil {
+			s.logger.WithError(err).Warnf("生成设备名称失败，使用默认命名: %s", stream.Name)
+			meta = DeviceMeta{Attributes: map[string]interface{}{}}
+		}
+	}
 
 	// 使用动态注册API
-	result, err := s.platformClient.DynamicRegister(stream.Name)
+	result, err := s.platformClient.DynamicRegister(stream.Name, meta.Name)
 	if err != nil {
 		// 如果是设备已存在错误，则获取设备信息继续往下走
-		// 注意：这里的错误匹配需要根据SDK返回的实际错误信息来定
-		// SDK error: "直连设备动态注册失败: 设备已存在"
-		if strings.Contains(err.Error(), "已存在") || strings.Contains(err.Error(), "exists") {
+		if errors.Is(err, platform.ErrAlreadyExists) {
 			s.logger.Debugf("设备 %s 已存在，尝试获取ID并更新属性", stream.Name)
 			device, errGet := s.platformClient.GetDevice(stream.Name)
 			if errGet != nil {
-				return fmt.Errorf("设备已存在但获取信息失败: %v", errGet)
+				return false, fmt.Errorf("设备已存在但获取信息失败: %w", errGet)
 			}
 			deviceID = device.ID
 		} else {
-			return err
+			return false, err
 		}
 	} else {
 		deviceID = result.DeviceID
+		created = true
 		s.logger.WithFields(logrus.Fields{
 			"device_id":     deviceID,
 			"device_number": stream.Name,
+			"device_name":   meta.Name,
 			"stream_url":    stream.URL,
 		}).Info("设备动态注册成功")
 	}
 
+	s.devices.put(deviceID, s.accessPointID, stream.Name)
+
 	// 发送设备在线状态
 	if err := s.platformClient.SendDeviceStatus(deviceID, platform.DeviceStatusOnline); err != nil {
 		s.logger.WithError(err).Warn("发送设备在线状态失败")
 	}
 
-	// 上报流地址属性
+	emitEvent(s.platformClient, s.logger, deviceID, EventStreamStarted, map[string]interface{}{
+		"stream_name":  stream.Name,
+		"stream_url":   redactURL(stream.URL),
+		"access_point": s.accessPointID,
+		"new_device":   created,
+	})
+
+	// 流重新出现时撤销下线记录
+	if s.offboarder != nil {
+		s.offboarder.Restore(stream.Name, deviceID)
+	}
+
+	// 上报流地址及模板生成的初始属性
+	attrs := meta.Attributes
 	if stream.URL != "" {
-		attrs := map[string]interface{}{
-			"stream_url": stream.URL,
-		}
+		attrs["stream_url"] = stream.URL
+	}
+	if len(attrs) > 0 {
 		if err := s.platformClient.SendAttributes(deviceID, attrs); err != nil {
 			s.logger.WithError(err).Warn("发送流地址属性失败")
 		} else {
@@ -177,11 +465,11 @@ func (s *DeviceSyncService) registerDevice(stream StreamInfo) error {
 		}
 	}
 
-	return nil
+	return created, nil
 }
 
 // sendDeviceOffline 发送设备离线状态
-func (s *DeviceSyncService) sendDeviceOffline(streamName string) {
+func (s *DeviceSyncService) sendDeviceOffline(streamName, reason string) {
 	// 获取设备信息
 	device, err := s.platformClient.GetDevice(streamName)
 	if err != nil {
@@ -193,6 +481,21 @@ func (s *DeviceSyncService) sendDeviceOffline(streamName string) {
 	if err := s.platformClient.SendDeviceStatus(device.ID, platform.DeviceStatusOffline); err != nil {
 		s.logger.WithError(err).Warnf("发送设备离线状态失败: %s", streamName)
 	}
+	emitEvent(s.platformClient, s.logger, device.ID, EventStreamLost, map[string]interface{}{
+		"stream_name":  streamName,
+		"access_point": s.accessPointID,
+		"reason":       reason,
+	})
+}
+
+// AccessPointID 获取所属服务接入点ID
+func (s *DeviceSyncService) AccessPointID() string {
+	return s.accessPointID
+}
+
+// DeadLetters 获取多次重试仍失败的设备
+func (s *DeviceSyncService) DeadLetters() []DeadLetter {
+	return s.deadLetters.list()
 }
 
 // GetSyncedDevices 获取已同步设备列表
@@ -206,3 +509,18 @@ func (s *DeviceSyncService) GetSyncedDevices() []string {
 	}
 	return devices
 }
+
+// forget 从已同步列表中移除设备，流重新出现时按新设备注册
+func (s *DeviceSyncService) forget(name string) {
+	s.syncedMutex.Lock()
+	delete(s.syncedDevices, name)
+	s.syncedMutex.Unlock()
+	s.devices.remove(s.accessPointID, name)
+}
+
+// isSynced 设备是否已由本服务同步
+func (s *DeviceSyncService) isSynced(name string) bool {
+	s.syncedMutex.RLock()
+	defer s.syncedMutex.RUnlock()
+	return s.syncedDevices[name]
+}
@@ -0,0 +1,166 @@
+// internal/protocol/plugins/go2rtc/teardown.go
+package go2rtc
+
+import (
+	"errors"
+
+	"tp-plugin/internal/pkg/logger"
+	"tp-plugin/internal/platform"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TeardownConfig 平台删除设备或断开连接后的清理策略
+type TeardownConfig struct {
+	RemoveStream      bool // 从go2rtc移除流(含子码流)，否则保留
+	StopWorkers       bool // 停止录像与定时抓图，移除流时总是停止
+	CloseDeviceLogger bool // 关闭设备日志文件
+	SendOffline       bool // 上报最终离线状态
+}
+
+// DefaultTeardownConfig 默认保留流，其余资源全部释放
+func DefaultTeardownConfig() TeardownConfig {
+	return TeardownConfig{StopWorkers: true, CloseDeviceLogger: true, SendOffline: true}
+}
+
+// Teardown 按策略释放设备在适配器和go2rtc中的资源，每一步写入日志和审计日志
+type Teardown struct {
+	manager        *SyncManager
+	controls       *ControlProcessor // 为nil时跳过录像与抓图
+	platformClient platform.Client
+	logger         *logrus.Logger
+	cfg            TeardownConfig
+}
+
+// NewTeardown 创建设备清理执行器
+func NewTeardown(manager *SyncManager, controls *ControlProcessor, platformClient platform.Client, logger *logrus.Logger, cfg TeardownConfig) *Teardown {
+	logger.WithFields(logrus.Fields{
+		"remove_stream":       cfg.RemoveStream,
+		"stop_workers":        cfg.StopWorkers,
+		"close_device_logger": cfg.CloseDeviceLogger,
+		"send_offline":        cfg.SendOffline,
+	}).Info("设备清理策略已加载")
+	return &Teardown{
+		manager:        manager,
+		controls:       controls,
+		platformClient: platformClient,
+		logger:         logger,
+		cfg:            cfg,
+	}
+}
+
+// Device 清理平台已删除或断开的设备
+// 需在清除设备缓存之前调用：平台上已删除的设备只能从设备ID索引、缓存或流控制记录中找到对应的流
+func (t *Teardown) Device(deviceID, reason string) {
+	entry := t.logger.WithFields(logrus.Fields{
+		"device_id": deviceID,
+		"reason":    reason,
+	})
+	audit := map[string]interface{}{
+		"device_id": deviceID,
+		"reason":    reason,
+	}
+
+	service, name := t.resolve(deviceID)
+	if name != "" {
+		entry = entry.WithField("stream", name)
+		audit["device_number"] = name
+	}
+	if service != nil {
+		entry = entry.WithField("access_point", service.AccessPointID())
+		audit["access_point"] = service.AccessPointID()
+	}
+	if service == nil {
+		entry.Warn("未找到设备对应的流，跳过go2rtc清理")
+	}
+
+	actions := []string{}
+	if service != nil && (t.cfg.StopWorkers || t.cfg.RemoveStream) && t.controls != nil {
+		if t.controls.release(service.AccessPointID(), name) {
+			entry.Info("清理: 已停止录像与定时抓图")
+			actions = append(actions, "stop_workers")
+		}
+		// 断开也可能来自平台修改设备配置，只有确认设备已删除才修改控制记录
+		if t.deleted(deviceID) {
+			t.controls.forget(service.AccessPointID(), name, t.cfg.RemoveStream)
+			entry.Info("清理: 设备已从平台删除，已清除录像与抓图设置")
+			actions = append(actions, "clear_controls")
+		}
+	}
+	if service != nil && t.cfg.RemoveStream {
+		if err := t.removeStream(service, name); err != nil {
+			entry.WithError(err).Error("清理: 从go2rtc移除流失败")
+			audit["error"] = err.Error()
+		} else {
+			entry.Info("清理: 已从go2rtc移除流")
+			actions = append(actions, "remove_stream")
+		}
+	} else if service != nil {
+		entry.Info("清理: 按策略保留go2rtc流")
+	}
+	if name != "" && t.cfg.CloseDeviceLogger {
+		logger.CleanupDeviceLogger(name)
+		entry.Info("清理: 已关闭设备日志")
+		actions = append(actions, "close_device_logger")
+	}
+	if t.cfg.SendOffline {
+		if err := t.platformClient.SendDeviceStatus(deviceID, platform.DeviceStatusOffline); err != nil {
+			entry.WithError(err).Warn("清理: 发送最终离线状态失败")
+			audit["error"] = err.Error()
+		} else {
+			entry.Info("清理: 已发送最终离线状态")
+			actions = append(actions, "send_offline")
+		}
+	}
+
+	audit["actions"] = actions
+	logger.LogAudit("teardown", audit)
+}
+
+// resolve 查找设备对应的同步服务和流名称，找不到流时 service 为nil
+// 优先使用注册时记录的设备ID索引，设备已从平台删除时平台API查不到设备编号；
+// 索引中没有时再查平台，最后按流控制记录中的设备ID查找
+func (t *Teardown) resolve(deviceID string) (*DeviceSyncService, string) {
+	if service, name, ok := t.manager.LookupDevice(deviceID); ok && service != nil {
+		return service, name
+	}
+	service, name, err := t.manager.ResolveDevice(deviceID)
+	if err == nil {
+		return service, name
+	}
+	if !errors.Is(err, platform.ErrNotFound) {
+		t.logger.WithError(err).WithField("device_id", deviceID).Debug("查找设备对应的流失败")
+	}
+	if t.controls != nil {
+		for _, ctrl := range t.controls.store.List() {
+			if ctrl.DeviceID != deviceID {
+				continue
+			}
+			if service, ok := t.manager.GetService(ctrl.AccessPointID); ok {
+				return service, ctrl.Stream
+			}
+		}
+	}
+	return nil, name
+}
+
+// deleted 设备是否已从平台删除，先清除ID缓存避免缓存中的设备掩盖删除
+func (t *Teardown) deleted(deviceID string) bool {
+	t.platformClient.ClearDeviceCacheByID(deviceID)
+	_, err := t.platformClient.GetDeviceByID(deviceID)
+	return errors.Is(err, platform.ErrNotFound)
+}
+
+// removeStream 移除流和子码流，并从已同步列表中去掉，避免下次同步按流丢失处理
+func (t *Teardown) removeStream(service *DeviceSyncService, name string) error {
+	if err := service.handler.RemoveStream(name); err != nil {
+		return err
+	}
+	if _, err := service.handler.GetStream(name + substreamSuffix); err == nil {
+		if err := service.handler.RemoveStream(name + substreamSuffix); err != nil {
+			return err
+		}
+	}
+	service.forget(name)
+	return nil
+}
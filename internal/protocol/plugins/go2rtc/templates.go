@@ -0,0 +1,309 @@
+// internal/protocol/plugins/go2rtc/templates.go
+package go2rtc
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// 码流类型
+const (
+	StreamTypeMain = "main" // 主码流
+	StreamTypeSub  = "sub"  // 子码流
+)
+
+// URLTemplate 摄像头品牌取流地址模板
+// Main/Sub 使用 text/template 语法，可用字段见 URLParams
+type URLTemplate struct {
+	Brand       string `mapstructure:"brand" json:"brand"`               // 品牌标识，如 hikvision
+	Label       string `mapstructure:"label" json:"label"`               // 显示名称
+	DefaultPort int    `mapstructure:"default_port" json:"default_port"` // 默认端口
+	Main        string `mapstructure:"main" json:"main"`                 // 主码流模板
+	Sub         string `mapstructure:"sub" json:"sub"`                   // 子码流模板(为空时使用主码流模板)
+}
+
+// URLParams 渲染取流地址的参数
+type URLParams struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Channel  int
+	Stream   string // main/sub
+}
+
+// urlTemplateData 模板渲染时可用的数据
+type urlTemplateData struct {
+	Auth    string // 已转义的 "user:pass@"，无用户名时为空
+	Host    string
+	Port    int
+	Channel int
+	Stream  string
+	Subtype int // 主码流为0，子码流为1
+}
+
+// builtinTemplates 内置品牌模板
+var builtinTemplates = []URLTemplate{
+	{
+		Brand:       "hikvision",
+		Label:       "海康威视",
+		DefaultPort: 554,
+		Main:        "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/Streaming/Channels/{{.Channel}}01",
+		Sub:         "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/Streaming/Channels/{{.Channel}}02",
+	},
+	{
+		Brand:       "dahua",
+		Label:       "大华",
+		DefaultPort: 554,
+		Main:        "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/cam/realmonitor?channel={{.Channel}}&subtype={{.Subtype}}",
+	},
+	{
+		Brand:       "uniview",
+		Label:       "宇视",
+		DefaultPort: 554,
+		Main:        "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/unicast/c{{.Channel}}/s{{.Subtype}}/live",
+	},
+	{
+		Brand:       "reolink",
+		Label:       "Reolink",
+		DefaultPort: 554,
+		Main:        `rtsp://{{.Auth}}{{.Host}}:{{.Port}}/h264Preview_{{printf "%02d" .Channel}}_main`,
+		Sub:         `rtsp://{{.Auth}}{{.Host}}:{{.Port}}/h264Preview_{{printf "%02d" .Channel}}_sub`,
+	},
+	{
+		Brand:       "axis",
+		Label:       "Axis",
+		DefaultPort: 554,
+		Main:        "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/axis-media/media.amp?camera={{.Channel}}",
+		Sub:         "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/axis-media/media.amp?camera={{.Channel}}&resolution=640x360",
+	},
+	{
+		Brand:       "onvif",
+		Label:       "通用ONVIF",
+		DefaultPort: 80,
+		Main:        "onvif://{{.Auth}}{{.Host}}:{{.Port}}?subtype={{.Subtype}}",
+	},
+}
+
+// TemplateLibrary 取流地址模板库
+// 内置模板之外可从YAML文件加载自定义模板，文件修改后下次查询时自动重新加载
+type TemplateLibrary struct {
+	mu      sync.RWMutex
+	path    string        // 自定义模板文件路径，为空表示仅使用内置模板
+	modTime time.Time     // 已加载文件的修改时间
+	custom  []URLTemplate // 自定义模板，同名品牌覆盖内置模板
+	logger  *logrus.Logger
+}
+
+// defaultLibrary 全局模板库
+var defaultLibrary = &TemplateLibrary{logger: logrus.StandardLogger()}
+
+// InitTemplateLibrary 设置自定义模板文件并立即加载
+func InitTemplateLibrary(path string) error {
+	defaultLibrary.mu.Lock()
+	defaultLibrary.path = path
+	defaultLibrary.modTime = time.Time{}
+	defaultLibrary.custom = nil
+	defaultLibrary.mu.Unlock()
+
+	if path == "" {
+		return nil
+	}
+	return defaultLibrary.reload()
+}
+
+// reloadIfChanged 文件修改时间变化时重新加载
+func (l *TemplateLibrary) reloadIfChanged() {
+	l.mu.RLock()
+	path, modTime := l.path, l.modTime
+	l.mu.RUnlock()
+	if path == "" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	if err := l.reload(); err != nil {
+		l.logger.WithError(err).Warnf("重新加载摄像头模板失败: %s", path)
+	}
+}
+
+// reload 从文件加载自定义模板
+// 文件格式:
+//
+//	templates:
+//	  - brand: mybrand
+//	    label: 自定义品牌
+//	    default_port: 554
+//	    main: "rtsp://{{.Auth}}{{.Host}}:{{.Port}}/live/{{.Channel}}"
+func (l *TemplateLibrary) reload() error {
+	l.mu.RLock()
+	path := l.path
+	l.mu.RUnlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("读取摄像头模板文件失败: %v", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("读取摄像头模板文件失败: %v", err)
+	}
+
+	var custom []URLTemplate
+	if err := v.UnmarshalKey("templates", &custom); err != nil {
+		return fmt.Errorf("解析摄像头模板失败: %v", err)
+	}
+
+	valid := custom[:0]
+	for _, t := range custom {
+		t.Brand = strings.ToLower(strings.TrimSpace(t.Brand))
+		if t.Brand == "" || t.Main == "" {
+			l.logger.Warnf("忽略无效的摄像头模板: %+v", t)
+			continue
+		}
+		if _, err := template.New(t.Brand).Parse(t.Main + t.Sub); err != nil {
+			l.logger.WithError(err).Warnf("忽略无法解析的摄像头模板: %s", t.Brand)
+			continue
+		}
+		if t.Label == "" {
+			t.Label = t.Brand
+		}
+		valid = append(valid, t)
+	}
+
+	l.mu.Lock()
+	l.custom = valid
+	l.modTime = info.ModTime()
+	l.mu.Unlock()
+
+	l.logger.WithFields(logrus.Fields{
+		"path":  path,
+		"count": len(valid),
+	}).Info("摄像头模板已加载")
+	return nil
+}
+
+// find 按品牌查找模板，自定义模板优先
+func (l *TemplateLibrary) find(brand string) (URLTemplate, bool) {
+	l.reloadIfChanged()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, t := range l.custom {
+		if t.Brand == brand {
+			return t, true
+		}
+	}
+	for _, t := range builtinTemplates {
+		if t.Brand == brand {
+			return t, true
+		}
+	}
+	return URLTemplate{}, false
+}
+
+// list 列出全部模板，内置模板在前，自定义模板按品牌排序
+func (l *TemplateLibrary) list() []URLTemplate {
+	l.reloadIfChanged()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	overridden := make(map[string]URLTemplate, len(l.custom))
+	for _, t := range l.custom {
+		overridden[t.Brand] = t
+	}
+
+	result := make([]URLTemplate, 0, len(builtinTemplates)+len(l.custom))
+	for _, t := range builtinTemplates {
+		if o, ok := overridden[t.Brand]; ok {
+			t = o
+			delete(overridden, t.Brand)
+		}
+		result = append(result, t)
+	}
+
+	extra := make([]URLTemplate, 0, len(overridden))
+	for _, t := range overridden {
+		extra = append(extra, t)
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i].Brand < extra[j].Brand })
+	return append(result, extra...)
+}
+
+// FindURLTemplate 按品牌查找模板(不区分大小写)
+func FindURLTemplate(brand string) (URLTemplate, bool) {
+	return defaultLibrary.find(strings.ToLower(strings.TrimSpace(brand)))
+}
+
+// ListURLTemplates 列出当前可用的全部模板
+func ListURLTemplates() []URLTemplate {
+	return defaultLibrary.list()
+}
+
+// RenderStreamURL 根据品牌模板渲染取流地址
+func RenderStreamURL(brand string, params URLParams) (string, error) {
+	tpl, ok := FindURLTemplate(brand)
+	if !ok {
+		return "", fmt.Errorf("不支持的摄像头品牌: %s", brand)
+	}
+	return tpl.Render(params)
+}
+
+// Render 渲染取流地址
+func (t URLTemplate) Render(params URLParams) (string, error) {
+	if params.Host == "" {
+		return "", fmt.Errorf("摄像头地址不能为空")
+	}
+
+	text := t.Main
+	data := urlTemplateData{
+		Host:    params.Host,
+		Port:    params.Port,
+		Channel: params.Channel,
+		Stream:  StreamTypeMain,
+	}
+	if params.Stream == StreamTypeSub {
+		data.Stream = StreamTypeSub
+		data.Subtype = 1
+		if t.Sub != "" {
+			text = t.Sub
+		}
+	}
+	if data.Port <= 0 {
+		data.Port = t.DefaultPort
+	}
+	if data.Channel <= 0 {
+		data.Channel = 1
+	}
+	if params.Username != "" {
+		data.Auth = url.UserPassword(params.Username, params.Password).String() + "@"
+	}
+
+	tmpl, err := template.New(t.Brand).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析模板失败(%s): %v", t.Brand, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("渲染模板失败(%s): %v", t.Brand, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,300 @@
+// internal/protocol/plugins/go2rtc/watch.go
+package go2rtc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件变化后的合并等待时间，编辑器保存时通常会产生多次事件
+const configWatchDebounce = 200 * time.Millisecond
+
+// go2rtc 重启或重新加载配置后API才反映文件变化，同步前按间隔检查，超时后按API当前的流同步
+const (
+	configApplyTimeout  = 30 * time.Second
+	configApplyInterval = 500 * time.Millisecond
+)
+
+// StreamsChange go2rtc配置文件 streams 段的变化
+type StreamsChange struct {
+	Streams map[string][]string // 变化后的完整 streams 段
+	Added   []string
+	Removed []string
+	Changed []string // 源地址变化的流
+}
+
+// pending 返回go2rtc API中尚未反映的变化涉及的流名称
+// API只返回第一个生产者的地址，源地址变化的流只比较第一个源
+func (c StreamsChange) pending(streams []StreamInfo) []string {
+	current := make(map[string]StreamInfo, len(streams))
+	for _, stream := range streams {
+		current[stream.Name] = stream
+	}
+
+	var pending []string
+	for _, name := range c.Added {
+		if _, ok := current[name]; !ok {
+			pending = append(pending, name)
+		}
+	}
+	for _, name := range c.Removed {
+		if _, ok := current[name]; ok {
+			pending = append(pending, name)
+		}
+	}
+	for _, name := range c.Changed {
+		stream, ok := current[name]
+		sources := c.Streams[name]
+		if !ok || (len(sources) > 0 && stream.URL != "" && stream.URL != sources[0]) {
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+// ParseGo2RTCStreams 解析go2rtc配置文件中的 streams 段
+// 流的源可以是单个字符串或字符串列表，返回 流名称 -> 源列表
+func ParseGo2RTCStreams(data []byte) (map[string][]string, error) {
+	var cfg struct {
+		Streams map[string]interface{} `yaml:"streams"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析go2rtc配置失败: %v", err)
+	}
+
+	streams := make(map[string][]string, len(cfg.Streams))
+	for name, value := range cfg.Streams {
+		switch v := value.(type) {
+		case nil:
+			streams[name] = []string{}
+		case string:
+			streams[name] = []string{v}
+		case []interface{}:
+			sources := make([]string, 0, len(v))
+			for _, item := range v {
+				if src, ok := item.(string); ok {
+					sources = append(sources, src)
+				}
+			}
+			streams[name] = sources
+		default:
+			return nil, fmt.Errorf("流 %s 的源格式不支持", name)
+		}
+	}
+	return streams, nil
+}
+
+// ConfigWatcher 监听go2rtc配置文件，streams 段变化时回调
+// 监听所在目录而不是文件本身，兼容编辑器以重命名方式保存
+type ConfigWatcher struct {
+	path     string
+	logger   *logrus.Logger
+	onChange func(change StreamsChange)
+
+	streams map[string][]string // 上次解析的 streams 段
+	cancel  context.CancelFunc
+}
+
+// NewConfigWatcher 创建go2rtc配置文件监听器
+func NewConfigWatcher(path string, logger *logrus.Logger, onChange func(change StreamsChange)) (*ConfigWatcher, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("无效的go2rtc配置文件路径: %v", err)
+	}
+	return &ConfigWatcher{
+		path:     absPath,
+		logger:   logger,
+		onChange: onChange,
+	}, nil
+}
+
+// Start 开始监听
+func (w *ConfigWatcher) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建文件监听失败: %v", err)
+	}
+	if err := watcher.Add(filepath.Dir(w.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("监听go2rtc配置目录失败: %v", err)
+	}
+
+	// 记录初始内容，之后只在 streams 段变化时回调
+	if streams, err := w.load(); err == nil {
+		w.streams = streams
+	} else {
+		w.logger.WithError(err).Warn("读取go2rtc配置文件失败")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go w.loop(ctx, watcher)
+
+	w.logger.Infof("开始监听go2rtc配置文件: %s (%d个流)", w.path, len(w.streams))
+	return nil
+}
+
+// Stop 停止监听
+func (w *ConfigWatcher) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+func (w *ConfigWatcher) loop(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	var debounce *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != w.path {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			if debounce == nil {
+				debounce = time.NewTimer(configWatchDebounce)
+			} else {
+				if !debounce.Stop() {
+					select {
+					case <-debounce.C:
+					default:
+					}
+				}
+				debounce.Reset(configWatchDebounce)
+			}
+			fire = debounce.C
+
+		case <-fire:
+			fire = nil
+			w.reload()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.WithError(err).Warn("go2rtc配置文件监听错误")
+
+		case <-ctx.Done():
+			if debounce != nil {
+				debounce.Stop()
+			}
+			w.logger.Info("go2rtc配置文件监听已停止")
+			return
+		}
+	}
+}
+
+// reload 重新解析配置文件，streams 段变化时回调
+func (w *ConfigWatcher) reload() {
+	streams, err := w.load()
+	if err != nil {
+		// 文件可能正在写入或已被删除，等待下一次事件
+		w.logger.WithError(err).Warn("读取go2rtc配置文件失败")
+		return
+	}
+	if reflect.DeepEqual(streams, w.streams) {
+		w.logger.Debug("go2rtc配置文件已变化，streams 段未变化")
+		return
+	}
+
+	change := diffStreams(w.streams, streams)
+	w.logger.WithFields(logrus.Fields{
+		"added":   change.Added,
+		"removed": change.Removed,
+		"changed": change.Changed,
+		"total":   len(streams),
+	}).Info("go2rtc配置文件 streams 已变化")
+
+	w.streams = streams
+	w.onChange(change)
+}
+
+func (w *ConfigWatcher) load() (map[string][]string, error) {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGo2RTCStreams(data)
+}
+
+// diffStreams 比较两次解析结果
+func diffStreams(before, after map[string][]string) StreamsChange {
+	change := StreamsChange{Streams: after}
+	for name, sources := range after {
+		previous, ok := before[name]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, name)
+		case !reflect.DeepEqual(previous, sources):
+			change.Changed = append(change.Changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			change.Removed = append(change.Removed, name)
+		}
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	sort.Strings(change.Changed)
+	return change
+}
+
+// syncAfterConfigChange 等待go2rtc API反映配置文件的变化后触发同步
+// 避免在go2rtc重新加载前同步到旧的流列表；超时仍未生效时照常同步，以API中的流为准
+func (s *DeviceSyncService) syncAfterConfigChange(change StreamsChange) {
+	deadline := time.Now().Add(configApplyTimeout)
+	for {
+		streams, err := s.handler.ListStreams()
+		var pending []string
+		if err == nil {
+			if pending = change.pending(streams); len(pending) == 0 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			entry := s.logger.WithField("pending", pending)
+			if err != nil {
+				entry = entry.WithError(err)
+			}
+			entry.Warn("go2rtc API 未反映配置文件的变化，按当前流列表同步")
+			break
+		}
+		select {
+		case <-time.After(configApplyInterval):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+	s.enqueue(SyncTriggerWatch)
+}
+
+// IsLocalAPIURL 判断go2rtc API地址是否指向本机
+func IsLocalAPIURL(apiURL string) bool {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+// internal/protocol/plugins/go2rtc/worker.go
+package go2rtc
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 同步并发与重试默认值
+const (
+	defaultSyncWorkers     = 8
+	defaultSyncMaxRetries  = 3
+	defaultRetryBaseDelay  = time.Second
+	defaultRetryMaxDelay   = 30 * time.Second
+	defaultDeadLetterRetry = 10 * time.Minute
+	retryJitterFraction    = 0.5 // 退避时间的随机抖动比例
+	maxBackoffShift        = 16
+)
+
+// RetryPolicy 单设备注册的重试策略
+type RetryPolicy struct {
+	MaxRetries      int           // 首次失败后的最大重试次数
+	BaseDelay       time.Duration // 首次重试等待时间，之后按指数增长
+	MaxDelay        time.Duration // 单次等待上限
+	DeadLetterRetry time.Duration // 进入死信列表的设备多久后再次尝试
+}
+
+// withDefaults 填充未配置的字段
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	} else if p.MaxRetries == 0 {
+		p.MaxRetries = defaultSyncMaxRetries
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	if p.DeadLetterRetry <= 0 {
+		p.DeadLetterRetry = defaultDeadLetterRetry
+	}
+	return p
+}
+
+// backoff 第 attempt 次重试(从1开始)前的等待时间，带随机抖动
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	shift := attempt - 1
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	delay := p.BaseDelay << uint(shift)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// 在 [delay*(1-jitter), delay] 区间内随机，避免大量设备同时重试
+	jitter := time.Duration(rand.Float64() * retryJitterFraction * float64(delay))
+	return delay - jitter
+}
+
+// DeadLetter 多次重试后仍同步失败的设备
+type DeadLetter struct {
+	AccessPointID string    `json:"access_point_id"`
+	StreamName    string    `json:"stream_name"`
+	StreamURL     string    `json:"stream_url"` // 已隐藏密码
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	ErrorCode     int       `json:"error_code,omitempty"` // 平台响应业务码
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	LastFailedAt  time.Time `json:"last_failed_at"`
+	NextRetryAt   time.Time `json:"next_retry_at"`
+
+	rawURL string `json:"-"` // 原始流地址，用于判断地址是否变化
+}
+
+// deadLetterList 死信列表
+type deadLetterList struct {
+	mu      sync.RWMutex
+	entries map[string]*DeadLetter // 流名称 -> 死信
+}
+
+func newDeadLetterList() *deadLetterList {
+	return &deadLetterList{entries: make(map[string]*DeadLetter)}
+}
+
+// add 记录失败设备，已存在时累计尝试次数
+func (l *deadLetterList) add(entry DeadLetter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if existing, ok := l.entries[entry.StreamName]; ok {
+		entry.Attempts += existing.Attempts
+		entry.FirstFailedAt = existing.FirstFailedAt
+	}
+	l.entries[entry.StreamName] = &entry
+}
+
+// remove 删除死信记录
+func (l *deadLetterList) remove(streamName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, streamName)
+}
+
+// blocked 判断流是否仍在死信等待期内
+// 流地址变化时立即允许重试
+func (l *deadLetterList) blocked(stream StreamInfo, now time.Time) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entry, ok := l.entries[stream.Name]
+	if !ok {
+		return false
+	}
+	return entry.rawURL == stream.URL && now.Before(entry.NextRetryAt)
+}
+
+// retain 删除已不存在的流对应的死信
+func (l *deadLetterList) retain(current map[string]bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name := range l.entries {
+		if !current[name] {
+			delete(l.entries, name)
+		}
+	}
+}
+
+// list 按流名称排序返回死信列表
+func (l *deadLetterList) list() []DeadLetter {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	result := make([]DeadLetter, 0, len(l.entries))
+	for _, entry := range l.entries {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StreamName < result[j].StreamName
+	})
+	return result
+}
+
+// runWorkers 以有限并发执行任务，等待全部完成或ctx取消
+func runWorkers(ctx context.Context, workers int, jobs []StreamInfo, fn func(StreamInfo)) {
+	if workers <= 0 {
+		workers = defaultSyncWorkers
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	queue := make(chan StreamInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				fn(job)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			close(queue)
+			wg.Wait()
+			return
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// retry 按重试策略执行，返回最后一次错误和总尝试次数
+// retryable 返回false的错误不再重试
+func retry(ctx context.Context, policy RetryPolicy, retryable func(error) bool, fn func() error) (int, error) {
+	attempts := 0
+	for {
+		attempts++
+		err := fn()
+		if err == nil || attempts > policy.MaxRetries || !retryable(err) {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(policy.backoff(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, err
+		}
+	}
+}